@@ -6,6 +6,7 @@ import (
 
 	"github.com/flashbots/kube-sidecar-injector/config"
 	"github.com/flashbots/kube-sidecar-injector/global"
+	"github.com/flashbots/kube-sidecar-injector/render"
 	"github.com/flashbots/kube-sidecar-injector/server"
 	"github.com/urfave/cli/v2"
 )
@@ -57,6 +58,30 @@ func CommandServe(cfg *config.Config, globalFlags []cli.Flag) *cli.Command {
 			Usage:       "`name` of mutating webhook configuration to use",
 			Value:       global.AppName,
 		},
+
+		&cli.BoolFlag{
+			Category:    categoryK8S,
+			Destination: &cfg.K8S.DisableDefaultExclusions,
+			EnvVars:     []string{envPrefix + "DISABLE_DEFAULT_EXCLUSIONS"},
+			Name:        "disable-default-exclusions",
+			Usage:       "let the webhooks match the injector's own namespace, kube-system, and the injector's own pods",
+		},
+
+		&cli.BoolFlag{
+			Category:    categoryK8S,
+			Destination: &cfg.K8S.DisableNamespaceAnnotations,
+			EnvVars:     []string{envPrefix + "DISABLE_NAMESPACE_ANNOTATIONS"},
+			Name:        "disable-namespace-annotations",
+			Usage:       "ignore the inject annotations of the namespaces (the injector then does not watch them)",
+		},
+
+		&cli.BoolFlag{
+			Category:    categoryK8S,
+			Destination: &cfg.K8S.DisableMatchConditions,
+			EnvVars:     []string{envPrefix + "DISABLE_MATCH_CONDITIONS"},
+			Name:        "disable-match-conditions",
+			Usage:       "leave match conditions out of the webhooks (for k8s older than v1.28)",
+		},
 	}
 
 	serverFlags := []cli.Flag{
@@ -78,6 +103,15 @@ func CommandServe(cfg *config.Config, globalFlags []cli.Flag) *cli.Command {
 			Value:       "/",
 		},
 
+		&cli.StringFlag{
+			Category:    categoryServer,
+			Destination: &cfg.Server.PathMetrics,
+			EnvVars:     []string{envPrefix + "PATH_METRICS"},
+			Name:        "path-metrics",
+			Usage:       "`path` at which to serve the prometheus metrics",
+			Value:       "/metrics",
+		},
+
 		&cli.StringFlag{
 			Category:    categoryServer,
 			Destination: &cfg.Server.PathWebhook,
@@ -104,12 +138,18 @@ func CommandServe(cfg *config.Config, globalFlags []cli.Flag) *cli.Command {
 				if i.MaxIterations <= 0 {
 					i.MaxIterations = config.DefaultMaxIterations
 				}
-				if i.LabelSelector != nil {
-					if _, err := i.LabelSelector.LabelSelector(); err != nil {
-						return err
-					}
+			}
+			if err := config.ValidateInjects(cfg.Inject); err != nil {
+				return err
+			}
+			for _, i := range cfg.Inject {
+				if err := render.CheckInject(i); err != nil {
+					return fmt.Errorf("invalid template in inject-configuration '%s': %w",
+						i.Name, err,
+					)
 				}
-				for _, c := range i.Containers {
+				// containers are checked with the templates rendered for defaults
+				for _, c := range render.Defaults(i).Containers {
 					if _, err := c.Container(); err != nil {
 						return fmt.Errorf("invalid config for container '%s': %w",
 							c.Name, err,
@@ -0,0 +1,45 @@
+package config
+
+import (
+	"errors"
+	"fmt"
+	"hash"
+)
+
+// ConflictPolicy defines what the injector should do when the pod already has
+// the setting that is about to be injected.
+type ConflictPolicy string
+
+const (
+	// ConflictPolicySkip keeps the pod's own setting
+	ConflictPolicySkip ConflictPolicy = "skip"
+
+	// ConflictPolicyOverride replaces the pod's own setting with the injected one
+	ConflictPolicyOverride ConflictPolicy = "override"
+
+	// ConflictPolicyMerge keeps the pod's own setting, and fills in the fields
+	// that it does not set from the injected one
+	ConflictPolicyMerge ConflictPolicy = "merge"
+
+	// ConflictPolicyFail denies the admission of the pod
+	ConflictPolicyFail ConflictPolicy = "fail"
+)
+
+var (
+	errConflictPolicyInvalid = errors.New("invalid conflict policy")
+)
+
+func (cp ConflictPolicy) hash(sum hash.Hash64) {
+	sum.Write([]byte("onConflict:"))
+	sum.Write([]byte(cp))
+	sum.Write([]byte{255})
+}
+
+func (cp ConflictPolicy) Validate() error {
+	switch cp {
+	case "", ConflictPolicySkip, ConflictPolicyOverride, ConflictPolicyMerge, ConflictPolicyFail:
+		return nil
+	default:
+		return fmt.Errorf("%w: %s", errConflictPolicyInvalid, cp)
+	}
+}
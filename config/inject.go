@@ -1,8 +1,16 @@
 package config
 
 import (
+	"errors"
 	"fmt"
 	"hash/fnv"
+	"sort"
+	"strings"
+	"unsafe"
+
+	"github.com/flashbots/kube-sidecar-injector/global"
+	core_v1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/util/validation"
 )
 
 type Inject struct {
@@ -10,16 +18,323 @@ type Inject struct {
 
 	MaxIterations int `yaml:"maxIterations,omitempty"`
 
+	// OnConflict is the default conflict policy for the elements of this rule
+	// that do not define their own (default: skip)
+	OnConflict ConflictPolicy `yaml:"onConflict,omitempty"`
+
+	// Atomic drops the whole patch of the rule if any of its elements can not
+	// be injected (for example, it is skipped due to the conflict)
+	Atomic bool `yaml:"atomic,omitempty"`
+
+	Parameters []InjectParameter `yaml:"parameters,omitempty"`
+
 	LabelSelector     *InjectLabelSelector `yaml:"labelSelector,omitempty"`
 	NamespaceSelector *InjectLabelSelector `yaml:"namespaceSelector,omitempty"`
 
-	Labels map[string]string `yaml:"labels,omitempty"`
+	// MatchConditions are passed to the webhook of the rule, so that k8s
+	// api-server does not call it for the pods that would be skipped anyway
+	MatchConditions []InjectMatchCondition `yaml:"matchConditions,omitempty"`
+
+	// When lists the predicates that the pod must satisfy (all of them) for
+	// the rule to apply
+	When []InjectPredicate `yaml:"when,omitempty"`
+
+	OwnerKinds *InjectOwnerKinds `yaml:"ownerKinds,omitempty"`
+
+	// OwnerSelector matches the top-level owner of the pod (the owner chain
+	// is resolved through the informer cache of the injector)
+	OwnerSelector *InjectOwnerSelector `yaml:"ownerSelector,omitempty"`
+
+	// UserInfo matches the identity that makes the admission request
+	UserInfo *InjectUserInfo `yaml:"userInfo,omitempty"`
+
+	Rollout *InjectRollout `yaml:"rollout,omitempty"`
+
+	// OptIn makes the rule apply only to the pods (or namespaces) that are
+	// annotated with `sidecar.flashbots.net/inject-<name>: "true"`
+	OptIn bool `yaml:"optIn,omitempty"`
+
+	// OnDemand makes the rule apply only to the pods that request it by name
+	// with `sidecar.flashbots.net/inject: "<name>,<name>,..."`
+	OnDemand bool `yaml:"onDemand,omitempty"`
+
+	// Operations are the admission operations that the rule is applied on
+	// (default: CREATE and UPDATE)
+	Operations InjectOperations `yaml:"operations,omitempty"`
+
+	// Workloads makes the rule also mutate pod templates of deployments,
+	// stateful-sets, daemon-sets, jobs, and cron-jobs
+	Workloads bool `yaml:"workloads,omitempty"`
+
+	Annotations map[string]string `yaml:"annotations,omitempty"`
+	Labels      map[string]string `yaml:"labels,omitempty"`
 
 	Affinity     *InjectAffinity     `yaml:"affinity,omitempty"`
 	Containers   []InjectContainer   `yaml:"containers,omitempty"`
 	Tolerations  []InjectToleration  `yaml:"tolerations,omitempty"`
 	VolumeMounts []InjectVolumeMount `yaml:"volumeMounts,omitempty"`
 	Volumes      []InjectVolume      `yaml:"volumes,omitempty"`
+
+	Native *InjectNative `yaml:"native,omitempty"`
+
+	EphemeralContainers *InjectEphemeralContainers `yaml:"ephemeralContainers,omitempty"`
+
+	Fargate *InjectFargate `yaml:"fargate,omitempty"`
+
+	Jobs *InjectJobs `yaml:"jobs,omitempty"`
+
+	AutomountServiceAccountToken *InjectPodToggle `yaml:"automountServiceAccountToken,omitempty"`
+	EnableServiceLinks           *InjectPodToggle `yaml:"enableServiceLinks,omitempty"`
+	HostPID                      *InjectPodToggle `yaml:"hostPID,omitempty"`
+	ShareProcessNamespace        *InjectPodToggle `yaml:"shareProcessNamespace,omitempty"`
+}
+
+var (
+	errInjectDuplicateOnDemandName      = errors.New("duplicate name of on-demand inject-configuration")
+	errInjectInvalidAnnotation          = errors.New("invalid annotation")
+	errInjectInvalidOnDemandName        = errors.New("name of on-demand inject-configuration must not contain commas or spaces")
+	errInjectMatchConditionsOfWorkloads = errors.New("inject-configuration can not have both match conditions and workloads")
+	errInjectOnDemandMatchConditions    = errors.New("on-demand inject-configuration can not have match conditions")
+	errInjectOnDemandWorkloads          = errors.New("on-demand inject-configuration can not mutate workloads or ephemeral containers")
+	errInjectWithoutName                = errors.New("inject-configuration must have a name")
+)
+
+// InjectAnnotation returns the annotation with which pods and namespaces opt
+// in or out of the injection.
+func (i Inject) InjectAnnotation() string {
+	return global.AnnotationPrefix + "inject-" + i.Name
+}
+
+// Validate checks the rule on its own (the templates are checked by the render
+// package, and the names of the on-demand rules by ValidateInjects).
+func (i Inject) Validate() error {
+	policies := []ConflictPolicy{i.OnConflict}
+	for _, c := range i.Containers {
+		policies = append(policies, c.OnConflict)
+	}
+	for _, t := range i.Tolerations {
+		policies = append(policies, t.OnConflict)
+	}
+	for _, vm := range i.VolumeMounts {
+		policies = append(policies, vm.OnConflict)
+	}
+	for _, v := range i.Volumes {
+		policies = append(policies, v.OnConflict)
+	}
+	for _, p := range policies {
+		if err := p.Validate(); err != nil {
+			return fmt.Errorf("invalid conflict policy: %w", err)
+		}
+	}
+
+	if i.OptIn {
+		if i.Name == "" {
+			return fmt.Errorf("%w: opt-in", errInjectWithoutName)
+		}
+		if err := validateAnnotation(i.InjectAnnotation()); err != nil {
+			return err
+		}
+	}
+
+	if i.OnDemand {
+		if i.Name == "" {
+			return fmt.Errorf("%w: on-demand", errInjectWithoutName)
+		}
+		if strings.ContainsAny(i.Name, ", ") {
+			return fmt.Errorf("%w: %s", errInjectInvalidOnDemandName, i.Name)
+		}
+		if i.Workloads || i.EphemeralContainers != nil {
+			return errInjectOnDemandWorkloads
+		}
+		if len(i.MatchConditions) > 0 {
+			return errInjectOnDemandMatchConditions
+		}
+	}
+
+	if i.Workloads && len(i.MatchConditions) > 0 {
+		// match conditions evaluate the pods, not the workloads
+		return errInjectMatchConditionsOfWorkloads
+	}
+	if err := ValidateMatchConditions(i.MatchConditions); err != nil {
+		return fmt.Errorf("invalid match conditions: %w", err)
+	}
+
+	for _, p := range i.When {
+		if err := p.Validate(); err != nil {
+			return fmt.Errorf("invalid predicate: %w", err)
+		}
+	}
+	if i.OwnerKinds != nil {
+		if err := i.OwnerKinds.Validate(); err != nil {
+			return fmt.Errorf("invalid owner kinds: %w", err)
+		}
+	}
+	if i.OwnerSelector != nil {
+		if err := i.OwnerSelector.Validate(); err != nil {
+			return fmt.Errorf("invalid owner selector: %w", err)
+		}
+	}
+	if i.UserInfo != nil {
+		if err := i.UserInfo.Validate(); err != nil {
+			return fmt.Errorf("invalid user info: %w", err)
+		}
+	}
+	if err := i.Operations.Validate(); err != nil {
+		return fmt.Errorf("invalid operations: %w", err)
+	}
+	if i.Rollout != nil {
+		if err := i.Rollout.Validate(); err != nil {
+			return fmt.Errorf("invalid rollout: %w", err)
+		}
+	}
+	if i.LabelSelector != nil {
+		if _, err := i.LabelSelector.LabelSelector(); err != nil {
+			return fmt.Errorf("invalid label selector: %w", err)
+		}
+	}
+
+	for _, p := range i.Parameters {
+		if err := p.Validate(); err != nil {
+			return fmt.Errorf("invalid parameter: %w", err)
+		}
+		if i.Name == "" {
+			return fmt.Errorf("%w: with parameters", errInjectWithoutName)
+		}
+		if err := validateAnnotation(p.Annotation(&i)); err != nil {
+			return err
+		}
+	}
+
+	for _, c := range i.Containers {
+		if c.Resources == nil || c.Resources.Relative == nil {
+			continue
+		}
+		for _, relative := range []map[string]InjectRelativeQuantity{
+			c.Resources.Relative.Limits,
+			c.Resources.Relative.Requests,
+		} {
+			for name, rq := range relative {
+				if err := rq.Validate(); err != nil {
+					return fmt.Errorf("invalid relative resource '%s' for container '%s': %w",
+						name, c.Name, err,
+					)
+				}
+			}
+		}
+	}
+
+	volumeMounts := [][]InjectVolumeMount{i.VolumeMounts}
+	if i.EphemeralContainers != nil {
+		volumeMounts = append(volumeMounts, i.EphemeralContainers.VolumeMounts)
+	}
+	for _, mounts := range volumeMounts {
+		for _, vm := range mounts {
+			if vm.Containers == nil {
+				continue
+			}
+			if err := vm.Containers.Validate(); err != nil {
+				return fmt.Errorf("invalid container selector for volume mount '%s': %w",
+					vm.MountPath, err,
+				)
+			}
+		}
+	}
+
+	if i.Fargate != nil {
+		if err := i.Fargate.Validate(); err != nil {
+			return fmt.Errorf("invalid fargate config: %w", err)
+		}
+	}
+	if i.Jobs != nil {
+		if err := i.Jobs.Validate(); err != nil {
+			return fmt.Errorf("invalid jobs config: %w", err)
+		}
+	}
+
+	for _, t := range []struct {
+		name   string
+		toggle *InjectPodToggle
+	}{
+		{"automountServiceAccountToken", i.AutomountServiceAccountToken},
+		{"enableServiceLinks", i.EnableServiceLinks},
+		{"hostPID", i.HostPID},
+		{"shareProcessNamespace", i.ShareProcessNamespace},
+	} {
+		if t.toggle == nil {
+			continue
+		}
+		if err := t.toggle.OnConflict.Validate(); err != nil {
+			return fmt.Errorf("invalid config for toggle '%s': %w", t.name, err)
+		}
+	}
+
+	return nil
+}
+
+// ValidateInjects validates all of the rules, and makes sure that the names of
+// the on-demand ones are unique (the pods request them by name).
+func ValidateInjects(injects []*Inject) error {
+	onDemand := make(map[string]struct{}, len(injects))
+	for _, i := range injects {
+		if err := i.Validate(); err != nil {
+			return fmt.Errorf("invalid inject-configuration '%s': %w", i.Name, err)
+		}
+		if !i.OnDemand {
+			continue
+		}
+		if _, duplicate := onDemand[i.Name]; duplicate {
+			return fmt.Errorf("%w: %s", errInjectDuplicateOnDemandName, i.Name)
+		}
+		onDemand[i.Name] = struct{}{}
+	}
+	return nil
+}
+
+func validateAnnotation(annotation string) error {
+	if errs := validation.IsQualifiedName(annotation); len(errs) > 0 {
+		return fmt.Errorf("%w: %s: %s",
+			errInjectInvalidAnnotation, annotation, strings.Join(errs, "; "),
+		)
+	}
+	return nil
+}
+
+// Metadata returns the copy of the rule that only injects labels and
+// annotations (for the pods that are already running, as their spec is
+// immutable).
+func (i Inject) Metadata() *Inject {
+	return &Inject{
+		Name:          i.Name,
+		MaxIterations: i.MaxIterations,
+		OnConflict:    i.OnConflict,
+		Atomic:        i.Atomic,
+
+		Annotations: i.Annotations,
+		Labels:      i.Labels,
+	}
+}
+
+// Matches returns true if the pod satisfies all predicates of the rule.
+func (i Inject) Matches(pod *core_v1.Pod) bool {
+	for _, p := range i.When {
+		if !p.Matches(pod) {
+			return false
+		}
+	}
+	return true
+}
+
+// ConflictPolicy resolves the conflict policy of the element (the one that is
+// set for the element itself wins over the one of the rule).
+func (i Inject) ConflictPolicy(element ConflictPolicy) ConflictPolicy {
+	switch {
+	case element != "":
+		return element
+	case i.OnConflict != "":
+		return i.OnConflict
+	default:
+		return ConflictPolicySkip
+	}
 }
 
 func (i Inject) Fingerprint() string {
@@ -31,6 +346,38 @@ func (i Inject) Fingerprint() string {
 		sum.Write([]byte{255})
 	}
 
+	{ // maxIterations
+		sum.Write([]byte("maxIterations:"))
+		sum.Write(unsafe.Slice(
+			(*byte)(unsafe.Pointer(&i.MaxIterations)),
+			unsafe.Sizeof(i.MaxIterations),
+		))
+		sum.Write([]byte{255})
+	}
+
+	{ // onConflict
+		if i.OnConflict != "" {
+			i.OnConflict.hash(sum)
+		}
+	}
+
+	{ // atomic
+		if i.Atomic {
+			sum.Write([]byte("atomic:"))
+			sum.Write([]byte{255})
+		}
+	}
+
+	{ // parameters
+		if len(i.Parameters) > 0 {
+			sum.Write([]byte("parameters:"))
+			for _, p := range i.Parameters {
+				p.hash(sum)
+			}
+			sum.Write([]byte{255})
+		}
+	}
+
 	{ // labelSelector
 		if i.LabelSelector != nil {
 			sum.Write([]byte("labelSelector:"))
@@ -47,16 +394,113 @@ func (i Inject) Fingerprint() string {
 		}
 	}
 
+	{ // matchConditions
+		if len(i.MatchConditions) > 0 {
+			sum.Write([]byte("matchConditions:"))
+			for _, mc := range i.MatchConditions {
+				mc.hash(sum)
+			}
+			sum.Write([]byte{255})
+		}
+	}
+
+	{ // when
+		if len(i.When) > 0 {
+			sum.Write([]byte("when:"))
+			for _, p := range i.When {
+				p.hash(sum)
+			}
+			sum.Write([]byte{255})
+		}
+	}
+
+	{ // ownerKinds
+		if i.OwnerKinds != nil {
+			sum.Write([]byte("ownerKinds:"))
+			i.OwnerKinds.hash(sum)
+			sum.Write([]byte{255})
+		}
+	}
+
+	{ // ownerSelector
+		if i.OwnerSelector != nil {
+			sum.Write([]byte("ownerSelector:"))
+			i.OwnerSelector.hash(sum)
+			sum.Write([]byte{255})
+		}
+	}
+
+	{ // userInfo
+		if i.UserInfo != nil {
+			sum.Write([]byte("userInfo:"))
+			i.UserInfo.hash(sum)
+			sum.Write([]byte{255})
+		}
+	}
+
+	{ // rollout
+		if i.Rollout != nil {
+			sum.Write([]byte("rollout:"))
+			i.Rollout.hash(sum)
+			sum.Write([]byte{255})
+		}
+	}
+
+	{ // optIn
+		if i.OptIn {
+			sum.Write([]byte("optIn:"))
+			sum.Write([]byte{255})
+		}
+	}
+
+	{ // onDemand
+		if i.OnDemand {
+			sum.Write([]byte("onDemand:"))
+			sum.Write([]byte{255})
+		}
+	}
+
+	{ // operations
+		if len(i.Operations) > 0 {
+			sum.Write([]byte("operations:"))
+			i.Operations.hash(sum)
+			sum.Write([]byte{255})
+		}
+	}
+
+	{ // workloads
+		if i.Workloads {
+			sum.Write([]byte("workloads:"))
+			sum.Write([]byte{255})
+		}
+	}
+
+	{ // annotations
+		if len(i.Annotations) > 0 {
+			sum.Write([]byte("annotations:"))
+			for _, k := range sortedKeys(i.Annotations) {
+				sum.Write([]byte("key:"))
+				sum.Write([]byte(k))
+				sum.Write([]byte{255})
+
+				sum.Write([]byte("value:"))
+				sum.Write([]byte(i.Annotations[k]))
+				sum.Write([]byte{255})
+			}
+			sum.Write([]byte{255})
+		}
+	}
+
 	{ // labels
 		if len(i.Labels) > 0 {
 			sum.Write([]byte("labels:"))
-			for k, v := range i.Labels {
+			for _, k := range sortedKeys(i.Labels) {
 				sum.Write([]byte("key:"))
 				sum.Write([]byte(k))
 				sum.Write([]byte{255})
 
 				sum.Write([]byte("value:"))
-				sum.Write([]byte(v))
+				sum.Write([]byte(i.Labels[k]))
 				sum.Write([]byte{255})
 			}
 			sum.Write([]byte{255})
@@ -111,5 +555,82 @@ func (i Inject) Fingerprint() string {
 		}
 	}
 
+	{ // native
+		if i.Native != nil {
+			sum.Write([]byte("native:"))
+			i.Native.hash(sum)
+			sum.Write([]byte{255})
+		}
+	}
+
+	{ // ephemeralContainers
+		if i.EphemeralContainers != nil {
+			sum.Write([]byte("ephemeralContainers:"))
+			i.EphemeralContainers.hash(sum)
+			sum.Write([]byte{255})
+		}
+	}
+
+	{ // fargate
+		if i.Fargate != nil {
+			sum.Write([]byte("fargate:"))
+			i.Fargate.hash(sum)
+			sum.Write([]byte{255})
+		}
+	}
+
+	{ // jobs
+		if i.Jobs != nil {
+			sum.Write([]byte("jobs:"))
+			i.Jobs.hash(sum)
+			sum.Write([]byte{255})
+		}
+	}
+
+	{ // automountServiceAccountToken
+		if i.AutomountServiceAccountToken != nil {
+			sum.Write([]byte("automountServiceAccountToken:"))
+			i.AutomountServiceAccountToken.hash(sum)
+			sum.Write([]byte{255})
+		}
+	}
+
+	{ // enableServiceLinks
+		if i.EnableServiceLinks != nil {
+			sum.Write([]byte("enableServiceLinks:"))
+			i.EnableServiceLinks.hash(sum)
+			sum.Write([]byte{255})
+		}
+	}
+
+	{ // hostPID
+		if i.HostPID != nil {
+			sum.Write([]byte("hostPID:"))
+			i.HostPID.hash(sum)
+			sum.Write([]byte{255})
+		}
+	}
+
+	{ // shareProcessNamespace
+		if i.ShareProcessNamespace != nil {
+			sum.Write([]byte("shareProcessNamespace:"))
+			i.ShareProcessNamespace.hash(sum)
+			sum.Write([]byte{255})
+		}
+	}
+
 	return fmt.Sprintf("%016x", sum.Sum64())
 }
+
+func sortedKeys(m map[string]string) []string {
+	keys := make([]string, 0, len(m))
+	for k := range m {
+		keys = append(keys, k)
+	}
+	return sortedKeysOf(keys)
+}
+
+func sortedKeysOf(keys []string) []string {
+	sort.Strings(keys)
+	return keys
+}
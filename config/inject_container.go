@@ -9,13 +9,21 @@ import (
 type InjectContainer struct {
 	Name string `yaml:"name,omitempty"`
 
+	Position InjectContainerPosition `yaml:"position,omitempty"`
+
 	Image   string   `yaml:"image,omitempty"`
 	Command []string `yaml:"command,omitempty"`
 	Args    []string `yaml:"args,omitempty"`
 
+	Env []InjectEnvVar `yaml:"env,omitempty"`
+
 	Ports        []InjectContainerPort                `yaml:"ports,omitempty"`
 	Resources    *InjectContainerResourceRequirements `yaml:"resources,omitempty"`
 	VolumeMounts []InjectVolumeMount                  `yaml:"volumeMounts,omitempty"`
+
+	// OnConflict defines what to do when the pod already has the
+	// container with the same name (default: the one of the rule)
+	OnConflict ConflictPolicy `yaml:"onConflict,omitempty"`
 }
 
 func (c InjectContainer) hash(sum hash.Hash64) {
@@ -25,6 +33,14 @@ func (c InjectContainer) hash(sum hash.Hash64) {
 		sum.Write([]byte{255})
 	}
 
+	{ // position
+		if c.Position != "" {
+			sum.Write([]byte("position:"))
+			sum.Write([]byte(c.Position))
+			sum.Write([]byte{255})
+		}
+	}
+
 	{ // image
 		sum.Write([]byte("image:"))
 		sum.Write([]byte(c.Image))
@@ -53,6 +69,16 @@ func (c InjectContainer) hash(sum hash.Hash64) {
 		}
 	}
 
+	{ // env
+		if len(c.Env) > 0 {
+			sum.Write([]byte("env:"))
+			for _, ev := range c.Env {
+				ev.hash(sum)
+			}
+			sum.Write([]byte{255})
+		}
+	}
+
 	{ // ports
 		if len(c.Ports) > 0 {
 			sum.Write([]byte("ports:"))
@@ -80,9 +106,19 @@ func (c InjectContainer) hash(sum hash.Hash64) {
 			sum.Write([]byte{255})
 		}
 	}
+
+	{ // onConflict
+		if c.OnConflict != "" {
+			c.OnConflict.hash(sum)
+		}
+	}
 }
 
 func (c InjectContainer) Container() (*core_v1.Container, error) {
+	if _, _, err := c.Position.Parse(); err != nil {
+		return nil, err
+	}
+
 	ports := make([]core_v1.ContainerPort, 0, len(c.Ports))
 	for _, p := range c.Ports {
 		ports = append(ports, core_v1.ContainerPort{
@@ -94,6 +130,15 @@ func (c InjectContainer) Container() (*core_v1.Container, error) {
 		})
 	}
 
+	var env []core_v1.EnvVar
+	for _, ev := range c.Env {
+		envVar, err := ev.EnvVar()
+		if err != nil {
+			return nil, err
+		}
+		env = append(env, *envVar)
+	}
+
 	var resources core_v1.ResourceRequirements
 	if c.Resources != nil {
 		_resources, err := c.Resources.ResourceRequirements()
@@ -118,6 +163,7 @@ func (c InjectContainer) Container() (*core_v1.Container, error) {
 
 		Command: c.Command,
 		Args:    c.Args,
+		Env:     env,
 
 		Ports:        ports,
 		Resources:    resources,
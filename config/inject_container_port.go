@@ -22,6 +22,15 @@ func (cp InjectContainerPort) hash(sum hash.Hash64) {
 
 	{ // hostPort
 		sum.Write([]byte("hostPort:"))
+		sum.Write(unsafe.Slice(
+			(*byte)(unsafe.Pointer(&cp.HostPort)),
+			unsafe.Sizeof(cp.HostPort),
+		))
+		sum.Write([]byte{255})
+	}
+
+	{ // containerPort
+		sum.Write([]byte("containerPort:"))
 		sum.Write(unsafe.Slice(
 			(*byte)(unsafe.Pointer(&cp.ContainerPort)),
 			unsafe.Sizeof(cp.ContainerPort),
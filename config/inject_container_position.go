@@ -0,0 +1,46 @@
+package config
+
+import (
+	"errors"
+	"fmt"
+	"strings"
+)
+
+// InjectContainerPosition defines where the container is injected relative to
+// the containers that the pod already has:
+//
+//   - `first`
+//   - `last` (default)
+//   - `before:<name>`
+//   - `after:<name>`
+type InjectContainerPosition string
+
+const (
+	ContainerPositionFirst = "first"
+	ContainerPositionLast  = "last"
+
+	ContainerPositionBefore = "before"
+	ContainerPositionAfter  = "after"
+)
+
+var (
+	errContainerPositionInvalid = errors.New("invalid container position")
+)
+
+// Parse returns the kind of the position and the name of the container it is
+// relative to (only for `before` and `after` positions).
+func (cp InjectContainerPosition) Parse() (string, string, error) {
+	switch cp {
+	case "", ContainerPositionLast:
+		return ContainerPositionLast, "", nil
+	case ContainerPositionFirst:
+		return ContainerPositionFirst, "", nil
+	}
+
+	kind, container, found := strings.Cut(string(cp), ":")
+	if !found || container == "" || (kind != ContainerPositionBefore && kind != ContainerPositionAfter) {
+		return "", "", fmt.Errorf("%w: %s", errContainerPositionInvalid, cp)
+	}
+
+	return kind, container, nil
+}
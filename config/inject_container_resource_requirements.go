@@ -11,19 +11,23 @@ import (
 type InjectContainerResourceRequirements struct {
 	Limits   map[string]string `yaml:"limits,omitempty"`
 	Requests map[string]string `yaml:"requests,omitempty"`
+
+	// Relative resources are computed at admission from the pod's own requests
+	// (they take precedence over the fixed ones)
+	Relative *InjectRelativeResourceRequirements `yaml:"relative,omitempty"`
 }
 
 func (crr InjectContainerResourceRequirements) hash(sum hash.Hash64) {
 	{ // limits
 		if len(crr.Limits) > 0 {
 			sum.Write([]byte("limits:"))
-			for k, v := range crr.Limits {
+			for _, k := range sortedKeys(crr.Limits) {
 				sum.Write([]byte("key:"))
 				sum.Write([]byte(k))
 				sum.Write([]byte{255})
 
 				sum.Write([]byte("value:"))
-				sum.Write([]byte(v))
+				sum.Write([]byte(crr.Limits[k]))
 				sum.Write([]byte{255})
 			}
 			sum.Write([]byte{255})
@@ -33,18 +37,26 @@ func (crr InjectContainerResourceRequirements) hash(sum hash.Hash64) {
 	{ // requests
 		if len(crr.Requests) > 0 {
 			sum.Write([]byte("requests:"))
-			for k, v := range crr.Requests {
+			for _, k := range sortedKeys(crr.Requests) {
 				sum.Write([]byte("key:"))
 				sum.Write([]byte(k))
 				sum.Write([]byte{255})
 
 				sum.Write([]byte("value:"))
-				sum.Write([]byte(v))
+				sum.Write([]byte(crr.Requests[k]))
 				sum.Write([]byte{255})
 			}
 			sum.Write([]byte{255})
 		}
 	}
+
+	{ // relative
+		if crr.Relative != nil {
+			sum.Write([]byte("relative:"))
+			crr.Relative.hash(sum)
+			sum.Write([]byte{255})
+		}
+	}
 }
 
 func (crr InjectContainerResourceRequirements) ResourceRequirements() (*core_v1.ResourceRequirements, error) {
@@ -0,0 +1,96 @@
+package config
+
+import (
+	"hash"
+	"regexp"
+	"sync"
+)
+
+// InjectContainerSelector limits the containers that per-container injections
+// (like volume mounts) are applied to.  All patterns are regular expressions
+// that must match the whole name (or image).
+//
+// A container is selected when it matches any of include-patterns (or when
+// there are none) and does not match any of exclude-patterns.
+type InjectContainerSelector struct {
+	Names        []string `yaml:"names,omitempty"`
+	ExcludeNames []string `yaml:"excludeNames,omitempty"`
+
+	Images        []string `yaml:"images,omitempty"`
+	ExcludeImages []string `yaml:"excludeImages,omitempty"`
+}
+
+func (cs InjectContainerSelector) hash(sum hash.Hash64) {
+	for _, list := range []struct {
+		name     string
+		patterns []string
+	}{
+		{"names", cs.Names},
+		{"excludeNames", cs.ExcludeNames},
+		{"images", cs.Images},
+		{"excludeImages", cs.ExcludeImages},
+	} {
+		if len(list.patterns) > 0 {
+			sum.Write([]byte(list.name + ":"))
+			for _, p := range list.patterns {
+				sum.Write([]byte(p))
+				sum.Write([]byte{255})
+			}
+			sum.Write([]byte{255})
+		}
+	}
+}
+
+// Validate makes sure that all patterns are valid regular expressions
+func (cs InjectContainerSelector) Validate() error {
+	for _, patterns := range [][]string{cs.Names, cs.ExcludeNames, cs.Images, cs.ExcludeImages} {
+		for _, p := range patterns {
+			if _, err := compilePattern(p); err != nil {
+				return err
+			}
+		}
+	}
+	return nil
+}
+
+// Matches returns true if the container with given name and image is selected
+func (cs InjectContainerSelector) Matches(name, image string) bool {
+	if len(cs.Names) > 0 && !matchesAny(cs.Names, name) {
+		return false
+	}
+	if len(cs.Images) > 0 && !matchesAny(cs.Images, image) {
+		return false
+	}
+	if matchesAny(cs.ExcludeNames, name) || matchesAny(cs.ExcludeImages, image) {
+		return false
+	}
+	return true
+}
+
+var compiledPatterns sync.Map // pattern => *regexp.Regexp
+
+func compilePattern(pattern string) (*regexp.Regexp, error) {
+	if re, found := compiledPatterns.Load(pattern); found {
+		return re.(*regexp.Regexp), nil
+	}
+	re, err := regexp.Compile("^(?:" + pattern + ")$")
+	if err != nil {
+		return nil, err
+	}
+	compiledPatterns.Store(pattern, re)
+	return re, nil
+}
+
+func matchesAny(patterns []string, s string) bool {
+	for _, p := range patterns {
+		re, err := compilePattern(p)
+		if err != nil {
+			// invalid patterns are rejected at startup (see `Validate`)
+			continue
+		}
+		if re.MatchString(s) {
+			return true
+		}
+	}
+	return false
+}
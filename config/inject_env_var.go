@@ -0,0 +1,33 @@
+package config
+
+import (
+	"hash"
+
+	core_v1 "k8s.io/api/core/v1"
+)
+
+type InjectEnvVar struct {
+	Name  string `yaml:"name"`
+	Value string `yaml:"value,omitempty"`
+}
+
+func (ev InjectEnvVar) hash(sum hash.Hash64) {
+	{ // name
+		sum.Write([]byte("name:"))
+		sum.Write([]byte(ev.Name))
+		sum.Write([]byte{255})
+	}
+
+	{ // value
+		sum.Write([]byte("value:"))
+		sum.Write([]byte(ev.Value))
+		sum.Write([]byte{255})
+	}
+}
+
+func (ev InjectEnvVar) EnvVar() (*core_v1.EnvVar, error) {
+	return &core_v1.EnvVar{
+		Name:  ev.Name,
+		Value: ev.Value,
+	}, nil
+}
@@ -0,0 +1,44 @@
+package config
+
+import (
+	"hash"
+)
+
+// InjectEphemeralContainers defines mutations that are applied to ephemeral
+// containers (e.g. the ones created by `kubectl debug`) when they are being
+// added to the pod.
+type InjectEphemeralContainers struct {
+	Env             []InjectEnvVar         `yaml:"env,omitempty"`
+	SecurityContext *InjectSecurityContext `yaml:"securityContext,omitempty"`
+	VolumeMounts    []InjectVolumeMount    `yaml:"volumeMounts,omitempty"`
+}
+
+func (ec InjectEphemeralContainers) hash(sum hash.Hash64) {
+	{ // env
+		if len(ec.Env) > 0 {
+			sum.Write([]byte("env:"))
+			for _, ev := range ec.Env {
+				ev.hash(sum)
+			}
+			sum.Write([]byte{255})
+		}
+	}
+
+	{ // securityContext
+		if ec.SecurityContext != nil {
+			sum.Write([]byte("securityContext:"))
+			ec.SecurityContext.hash(sum)
+			sum.Write([]byte{255})
+		}
+	}
+
+	{ // volumeMounts
+		if len(ec.VolumeMounts) > 0 {
+			sum.Write([]byte("volumeMounts:"))
+			for _, vm := range ec.VolumeMounts {
+				vm.hash(sum)
+			}
+			sum.Write([]byte{255})
+		}
+	}
+}
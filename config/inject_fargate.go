@@ -0,0 +1,40 @@
+package config
+
+import (
+	"errors"
+	"fmt"
+	"hash"
+)
+
+// InjectFargate enables the check of the capacity that AWS EKS Fargate would
+// provision for the pod before and after the injection.
+type InjectFargate struct {
+	// OnTierChange is either `warn` (default) or `skip`
+	OnTierChange string `yaml:"onTierChange,omitempty"`
+}
+
+const (
+	FargateOnTierChangeSkip = "skip"
+	FargateOnTierChangeWarn = "warn"
+)
+
+var (
+	errFargateInvalidOnTierChange = errors.New("invalid fargate on-tier-change action")
+)
+
+func (f InjectFargate) hash(sum hash.Hash64) {
+	{ // onTierChange
+		sum.Write([]byte("onTierChange:"))
+		sum.Write([]byte(f.OnTierChange))
+		sum.Write([]byte{255})
+	}
+}
+
+func (f InjectFargate) Validate() error {
+	switch f.OnTierChange {
+	case "", FargateOnTierChangeSkip, FargateOnTierChangeWarn:
+		return nil
+	default:
+		return fmt.Errorf("%w: %s", errFargateInvalidOnTierChange, f.OnTierChange)
+	}
+}
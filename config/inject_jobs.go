@@ -0,0 +1,49 @@
+package config
+
+import (
+	"errors"
+	"fmt"
+	"hash"
+)
+
+// InjectJobs makes the injected containers exit along with the main containers
+// of the pods that are owned by jobs (otherwise the jobs would never complete).
+type InjectJobs struct {
+	// Sidecars is one of `auto` (default), `native`, or `wrapper`
+	Sidecars string `yaml:"sidecars,omitempty"`
+}
+
+const (
+	// JobSidecarsAuto uses native sidecars if the cluster supports them (k8s
+	// v1.29 or newer), and wrapper otherwise
+	JobSidecarsAuto = "auto"
+
+	// JobSidecarsNative injects the containers as init-containers with
+	// `restartPolicy: Always`
+	JobSidecarsNative = "native"
+
+	// JobSidecarsWrapper wraps the commands of the containers with the shell
+	// scripts that signal (and watch for) the completion via shared emptyDir
+	JobSidecarsWrapper = "wrapper"
+)
+
+var (
+	errJobsInvalidSidecars = errors.New("invalid jobs sidecars mode")
+)
+
+func (j InjectJobs) hash(sum hash.Hash64) {
+	{ // sidecars
+		sum.Write([]byte("sidecars:"))
+		sum.Write([]byte(j.Sidecars))
+		sum.Write([]byte{255})
+	}
+}
+
+func (j InjectJobs) Validate() error {
+	switch j.Sidecars {
+	case "", JobSidecarsAuto, JobSidecarsNative, JobSidecarsWrapper:
+		return nil
+	default:
+		return fmt.Errorf("%w: %s", errJobsInvalidSidecars, j.Sidecars)
+	}
+}
@@ -15,13 +15,13 @@ func (ls InjectLabelSelector) hash(sum hash.Hash64) {
 	{ // matchLabels
 		if len(ls.MatchLabels) > 0 {
 			sum.Write([]byte("matchLabels:"))
-			for k, v := range ls.MatchLabels {
+			for _, k := range sortedKeys(ls.MatchLabels) {
 				sum.Write([]byte("key:"))
 				sum.Write([]byte(k))
 				sum.Write([]byte{255})
 
 				sum.Write([]byte("value:"))
-				sum.Write([]byte(v))
+				sum.Write([]byte(ls.MatchLabels[k]))
 				sum.Write([]byte{255})
 			}
 			sum.Write([]byte{255})
@@ -0,0 +1,84 @@
+package config
+
+import (
+	"errors"
+	"fmt"
+	"hash"
+	"strings"
+
+	admission_registration_v1 "k8s.io/api/admissionregistration/v1"
+	"k8s.io/apimachinery/pkg/util/validation"
+)
+
+// InjectMatchCondition is the CEL expression that k8s api-server evaluates
+// before calling the webhook (requires k8s v1.28 or newer).
+type InjectMatchCondition struct {
+	Name       string `yaml:"name,omitempty"`
+	Expression string `yaml:"expression,omitempty"`
+}
+
+const (
+	// maxMatchConditions is the limit that k8s api-server imposes per webhook
+	maxMatchConditions = 64
+)
+
+var (
+	errMatchConditionDuplicateName = errors.New("duplicate match condition name")
+	errMatchConditionInvalidName   = errors.New("invalid match condition name")
+	errMatchConditionNoExpression  = errors.New("match condition must have an expression")
+	errMatchConditionsTooMany      = errors.New("too many match conditions")
+)
+
+func (mc InjectMatchCondition) hash(sum hash.Hash64) {
+	{ // name
+		sum.Write([]byte("name:"))
+		sum.Write([]byte(mc.Name))
+		sum.Write([]byte{255})
+	}
+
+	{ // expression
+		sum.Write([]byte("expression:"))
+		sum.Write([]byte(mc.Expression))
+		sum.Write([]byte{255})
+	}
+}
+
+func (mc InjectMatchCondition) Validate() error {
+	if errs := validation.IsQualifiedName(mc.Name); len(errs) > 0 {
+		return fmt.Errorf("%w: %s: %s",
+			errMatchConditionInvalidName, mc.Name, strings.Join(errs, "; "),
+		)
+	}
+	if strings.TrimSpace(mc.Expression) == "" {
+		return fmt.Errorf("%w: %s", errMatchConditionNoExpression, mc.Name)
+	}
+	return nil
+}
+
+func (mc InjectMatchCondition) MatchCondition() admission_registration_v1.MatchCondition {
+	return admission_registration_v1.MatchCondition{
+		Name:       mc.Name,
+		Expression: mc.Expression,
+	}
+}
+
+// ValidateMatchConditions checks the match conditions of the rule as a whole
+// (the expressions themselves are compiled by k8s api-server).
+func ValidateMatchConditions(conditions []InjectMatchCondition) error {
+	if len(conditions) > maxMatchConditions {
+		return fmt.Errorf("%w: %d (max %d)",
+			errMatchConditionsTooMany, len(conditions), maxMatchConditions,
+		)
+	}
+	names := make(map[string]struct{}, len(conditions))
+	for _, mc := range conditions {
+		if err := mc.Validate(); err != nil {
+			return err
+		}
+		if _, duplicate := names[mc.Name]; duplicate {
+			return fmt.Errorf("%w: %s", errMatchConditionDuplicateName, mc.Name)
+		}
+		names[mc.Name] = struct{}{}
+	}
+	return nil
+}
@@ -0,0 +1,112 @@
+package config
+
+import (
+	"bytes"
+	"encoding/json"
+	"hash"
+
+	"gopkg.in/yaml.v3"
+	core_v1 "k8s.io/api/core/v1"
+)
+
+// InjectNative holds the inject entries that are specified in the native k8s
+// format (as opposed to the `Inject*` mirror types).  This allows to use any
+// field supported by k8s api without the need to mirror it here first.
+type InjectNative struct {
+	Containers   []core_v1.Container   `json:"containers,omitempty"`
+	Tolerations  []core_v1.Toleration  `json:"tolerations,omitempty"`
+	VolumeMounts []core_v1.VolumeMount `json:"volumeMounts,omitempty"`
+	Volumes      []core_v1.Volume      `json:"volumes,omitempty"`
+}
+
+func (n *InjectNative) UnmarshalYAML(value *yaml.Node) error {
+	// k8s api types only come with json tags => re-encode yaml into json
+	var raw interface{}
+	if err := value.Decode(&raw); err != nil {
+		return err
+	}
+	b, err := json.Marshal(raw)
+	if err != nil {
+		return err
+	}
+
+	d := json.NewDecoder(bytes.NewReader(b))
+	d.DisallowUnknownFields()
+	var _n InjectNative
+	if err := d.Decode(&_n); err != nil {
+		return err
+	}
+	*n = _n
+
+	return nil
+}
+
+func (n InjectNative) MarshalYAML() (interface{}, error) {
+	b, err := json.Marshal(n)
+	if err != nil {
+		return nil, err
+	}
+
+	var res map[string]interface{}
+	if err := json.Unmarshal(b, &res); err != nil {
+		return nil, err
+	}
+
+	return res, nil
+}
+
+func (n InjectNative) hash(sum hash.Hash64) {
+	{ // containers
+		if len(n.Containers) > 0 {
+			sum.Write([]byte("containers:"))
+			for _, c := range n.Containers {
+				hashCanonical(sum, c)
+			}
+			sum.Write([]byte{255})
+		}
+	}
+
+	{ // tolerations
+		if len(n.Tolerations) > 0 {
+			sum.Write([]byte("tolerations:"))
+			for _, t := range n.Tolerations {
+				hashCanonical(sum, t)
+			}
+			sum.Write([]byte{255})
+		}
+	}
+
+	{ // volumeMounts
+		if len(n.VolumeMounts) > 0 {
+			sum.Write([]byte("volumeMounts:"))
+			for _, vm := range n.VolumeMounts {
+				hashCanonical(sum, vm)
+			}
+			sum.Write([]byte{255})
+		}
+	}
+
+	{ // volumes
+		if len(n.Volumes) > 0 {
+			sum.Write([]byte("volumes:"))
+			for _, v := range n.Volumes {
+				hashCanonical(sum, v)
+			}
+			sum.Write([]byte{255})
+		}
+	}
+}
+
+// hashCanonical writes canonical serialisation of the value into the sum.
+//
+// encoding/json emits struct fields in the order of their declaration and map
+// keys sorted, which makes its output suitable for the fingerprinting.
+func hashCanonical(sum hash.Hash64, v interface{}) {
+	b, err := json.Marshal(v)
+	if err != nil {
+		// k8s api types are always serialisable
+		panic(err)
+	}
+	sum.Write(b)
+	sum.Write([]byte{255})
+}
@@ -0,0 +1,58 @@
+package config
+
+import (
+	"errors"
+	"fmt"
+	"hash"
+
+	admission_registration_v1 "k8s.io/api/admissionregistration/v1"
+)
+
+// InjectOperations are the admission operations that the rule is applied on
+// (default: CREATE and UPDATE).
+type InjectOperations []admission_registration_v1.OperationType
+
+var (
+	errOperationsInvalid = errors.New("invalid admission operation")
+)
+
+func (o InjectOperations) hash(sum hash.Hash64) {
+	for _, op := range o {
+		sum.Write([]byte(op))
+		sum.Write([]byte{255})
+	}
+}
+
+func (o InjectOperations) Validate() error {
+	for _, op := range o {
+		switch op {
+		case admission_registration_v1.Create, admission_registration_v1.Update:
+		default:
+			return fmt.Errorf("%w: %s (must be one of: %s, %s)",
+				errOperationsInvalid, op, admission_registration_v1.Create, admission_registration_v1.Update,
+			)
+		}
+	}
+	return nil
+}
+
+// OperationTypes returns the operations with the default applied.
+func (o InjectOperations) OperationTypes() []admission_registration_v1.OperationType {
+	if len(o) == 0 {
+		return []admission_registration_v1.OperationType{
+			admission_registration_v1.Create,
+			admission_registration_v1.Update,
+		}
+	}
+	return o
+}
+
+// Allows returns true if the rule is applied on the operation.
+func (o InjectOperations) Allows(operation string) bool {
+	for _, op := range o.OperationTypes() {
+		if string(op) == operation {
+			return true
+		}
+	}
+	return false
+}
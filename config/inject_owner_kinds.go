@@ -0,0 +1,123 @@
+package config
+
+import (
+	"errors"
+	"hash"
+	"strings"
+
+	core_v1 "k8s.io/api/core/v1"
+	meta_v1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+)
+
+// InjectOwnerKinds limits the rule to the pods by the kind of their owner.
+//
+// Besides the kinds of k8s objects (`DaemonSet`, `Job`, `ReplicaSet`, ...)
+// there are two special ones: `MirrorPod` for the static pods of kubelet, and
+// `Pod` for the pods that have no owner.
+//
+// A pod is selected when the kind of its owner is in the include-list (or when
+// it is empty) and is not in the exclude-list.
+type InjectOwnerKinds struct {
+	Include []string `yaml:"include,omitempty"`
+	Exclude []string `yaml:"exclude,omitempty"`
+
+	// ResolveDeployments makes the pods owned by the replica-sets of the
+	// deployments be matched as `Deployment` (the replica-sets are looked up
+	// by the server, see OwnerKind)
+	ResolveDeployments bool `yaml:"resolveDeployments,omitempty"`
+}
+
+const (
+	OwnerKindMirrorPod = "MirrorPod"
+	OwnerKindPod       = "Pod"
+
+	// annotationMirrorPod is set by kubelet on the mirror pods
+	annotationMirrorPod = "kubernetes.io/config.mirror"
+)
+
+var (
+	errOwnerKindsEmptyKind = errors.New("owner kind must not be empty")
+)
+
+func (k InjectOwnerKinds) hash(sum hash.Hash64) {
+	for _, list := range []struct {
+		name  string
+		kinds []string
+	}{
+		{"include", k.Include},
+		{"exclude", k.Exclude},
+	} {
+		if len(list.kinds) > 0 {
+			sum.Write([]byte(list.name + ":"))
+			for _, kind := range list.kinds {
+				sum.Write([]byte(kind))
+				sum.Write([]byte{255})
+			}
+			sum.Write([]byte{255})
+		}
+	}
+
+	if k.ResolveDeployments {
+		sum.Write([]byte("resolveDeployments:"))
+		sum.Write([]byte{255})
+	}
+}
+
+func (k InjectOwnerKinds) Validate() error {
+	for _, kinds := range [][]string{k.Include, k.Exclude} {
+		for _, kind := range kinds {
+			if strings.TrimSpace(kind) == "" {
+				return errOwnerKindsEmptyKind
+			}
+		}
+	}
+	return nil
+}
+
+// Matches returns true if the pod with the owner of given kind is selected.
+func (k InjectOwnerKinds) Matches(kind string) bool {
+	if len(k.Include) > 0 && !containsKind(k.Include, kind) {
+		return false
+	}
+	return !containsKind(k.Exclude, kind)
+}
+
+// OwnerKind returns the kind of the direct owner of the pod (see
+// InjectOwnerKinds for the special ones).  The deployments of the replica-sets
+// can not be told from the pod alone, so with ResolveDeployments the server
+// resolves them on top of this.
+func (k InjectOwnerKinds) OwnerKind(pod *core_v1.Pod) string {
+	if _, mirror := pod.Annotations[annotationMirrorPod]; mirror {
+		return OwnerKindMirrorPod
+	}
+
+	owner := ownerOf(pod)
+	if owner == nil {
+		return OwnerKindPod
+	}
+
+	return owner.Kind
+}
+
+// ownerOf returns the controller of the pod (or its first owner, if none of
+// them is marked as the controller).
+func ownerOf(pod *core_v1.Pod) *meta_v1.OwnerReference {
+	if len(pod.OwnerReferences) == 0 {
+		return nil
+	}
+	for idx, owner := range pod.OwnerReferences {
+		if owner.Controller != nil && *owner.Controller {
+			return &pod.OwnerReferences[idx]
+		}
+	}
+	return &pod.OwnerReferences[0]
+}
+
+func containsKind(kinds []string, kind string) bool {
+	for _, k := range kinds {
+		if k == kind {
+			return true
+		}
+	}
+	return false
+}
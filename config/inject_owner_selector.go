@@ -0,0 +1,60 @@
+package config
+
+import (
+	"errors"
+	"hash"
+)
+
+// InjectOwnerSelector matches the labels and annotations of the top-level
+// owner of the pod (for example, the deployment of its replica-set).
+type InjectOwnerSelector struct {
+	InjectLabelSelector `yaml:",inline"`
+
+	MatchAnnotations []InjectPredicateKeyValue `yaml:"matchAnnotations,omitempty"`
+}
+
+var (
+	errOwnerSelectorMissingAnnotationKey = errors.New("owner selector annotation must have a key")
+)
+
+func (s InjectOwnerSelector) hash(sum hash.Hash64) {
+	s.InjectLabelSelector.hash(sum)
+
+	{ // matchAnnotations
+		if len(s.MatchAnnotations) > 0 {
+			sum.Write([]byte("matchAnnotations:"))
+			for _, kv := range s.MatchAnnotations {
+				kv.hash(sum)
+			}
+			sum.Write([]byte{255})
+		}
+	}
+}
+
+func (s InjectOwnerSelector) Validate() error {
+	if _, err := s.LabelSelector(); err != nil {
+		return err
+	}
+	for _, kv := range s.MatchAnnotations {
+		if kv.Key == "" {
+			return errOwnerSelectorMissingAnnotationKey
+		}
+		if kv.Value != "" {
+			if _, err := compilePattern(kv.Value); err != nil {
+				return err
+			}
+		}
+	}
+	return nil
+}
+
+// MatchesAnnotations returns true if the annotations of the owner match all
+// of the annotation selectors.
+func (s InjectOwnerSelector) MatchesAnnotations(annotations map[string]string) bool {
+	for _, kv := range s.MatchAnnotations {
+		if !kv.matches(annotations) {
+			return false
+		}
+	}
+	return true
+}
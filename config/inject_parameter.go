@@ -0,0 +1,165 @@
+package config
+
+import (
+	"errors"
+	"fmt"
+	"hash"
+	"slices"
+	"strconv"
+
+	"github.com/flashbots/kube-sidecar-injector/global"
+	"k8s.io/apimachinery/pkg/api/resource"
+	"k8s.io/apimachinery/pkg/util/validation"
+)
+
+// InjectParameter is a named value that the templates of the inject rule can
+// refer to (as `.Params.<name>`), and that pods can override with annotations.
+type InjectParameter struct {
+	Name string `yaml:"name"`
+
+	// Type is one of `string` (default), `int`, `bool`, or `quantity`
+	Type    string `yaml:"type,omitempty"`
+	Default string `yaml:"default,omitempty"`
+
+	// Min and Max are the bounds for `int` and `quantity` parameters
+	Min string `yaml:"min,omitempty"`
+	Max string `yaml:"max,omitempty"`
+
+	// Values are the allowed values for `string` parameters
+	Values []string `yaml:"values,omitempty"`
+}
+
+const (
+	ParameterTypeBool     = "bool"
+	ParameterTypeInt      = "int"
+	ParameterTypeQuantity = "quantity"
+	ParameterTypeString   = "string"
+)
+
+var (
+	errParameterInvalidName   = errors.New("invalid parameter name")
+	errParameterInvalidType   = errors.New("invalid parameter type")
+	errParameterInvalidValue  = errors.New("invalid parameter value")
+	errParameterOutOfBounds   = errors.New("parameter value is out of bounds")
+	errParameterInvalidBounds = errors.New("invalid parameter bounds")
+)
+
+func (p InjectParameter) hash(sum hash.Hash64) {
+	for _, field := range []struct {
+		name  string
+		value string
+	}{
+		{"name", p.Name},
+		{"type", p.Type},
+		{"default", p.Default},
+		{"min", p.Min},
+		{"max", p.Max},
+	} {
+		sum.Write([]byte(field.name + ":"))
+		sum.Write([]byte(field.value))
+		sum.Write([]byte{255})
+	}
+
+	{ // values
+		if len(p.Values) > 0 {
+			sum.Write([]byte("values:"))
+			for _, v := range p.Values {
+				sum.Write([]byte(v))
+				sum.Write([]byte{255})
+			}
+			sum.Write([]byte{255})
+		}
+	}
+}
+
+// Annotation returns the key of the annotation with which pods can override
+// the value of the parameter of the inject rule.
+func (p InjectParameter) Annotation(inject *Inject) string {
+	return global.AnnotationPrefix + inject.Name + "." + p.Name
+}
+
+// Validate makes sure that the parameter declaration is consistent
+func (p InjectParameter) Validate() error {
+	if errs := validation.IsConfigMapKey(p.Name); len(errs) > 0 {
+		return fmt.Errorf("%w: %s: %s", errParameterInvalidName, p.Name, errs[0])
+	}
+
+	switch p.Type {
+	case "", ParameterTypeString, ParameterTypeBool:
+		if p.Min != "" || p.Max != "" {
+			return fmt.Errorf("%w: %s: bounds are not supported by the type",
+				errParameterInvalidBounds, p.Name,
+			)
+		}
+	case ParameterTypeInt:
+		for _, b := range []string{p.Min, p.Max} {
+			if _, err := strconv.ParseInt(b, 10, 64); b != "" && err != nil {
+				return fmt.Errorf("%w: %s: %w", errParameterInvalidBounds, p.Name, err)
+			}
+		}
+	case ParameterTypeQuantity:
+		for _, b := range []string{p.Min, p.Max} {
+			if _, err := resource.ParseQuantity(b); b != "" && err != nil {
+				return fmt.Errorf("%w: %s: %w", errParameterInvalidBounds, p.Name, err)
+			}
+		}
+	default:
+		return fmt.Errorf("%w: %s: %s", errParameterInvalidType, p.Name, p.Type)
+	}
+
+	if len(p.Values) > 0 && p.Type != "" && p.Type != ParameterTypeString {
+		return fmt.Errorf("%w: %s: allowed values are only supported by string type",
+			errParameterInvalidBounds, p.Name,
+		)
+	}
+
+	if err := p.Check(p.Default); err != nil {
+		return fmt.Errorf("invalid default: %w", err)
+	}
+
+	return nil
+}
+
+// Check makes sure that the value is valid for the parameter
+func (p InjectParameter) Check(value string) error {
+	switch p.Type {
+	case "", ParameterTypeString:
+		if len(p.Values) > 0 && !slices.Contains(p.Values, value) {
+			return fmt.Errorf("%w: %s: %s", errParameterInvalidValue, p.Name, value)
+		}
+
+	case ParameterTypeBool:
+		if _, err := strconv.ParseBool(value); err != nil {
+			return fmt.Errorf("%w: %s: %w", errParameterInvalidValue, p.Name, err)
+		}
+
+	case ParameterTypeInt:
+		v, err := strconv.ParseInt(value, 10, 64)
+		if err != nil {
+			return fmt.Errorf("%w: %s: %w", errParameterInvalidValue, p.Name, err)
+		}
+		if min, err := strconv.ParseInt(p.Min, 10, 64); err == nil && v < min {
+			return fmt.Errorf("%w: %s: %d < %d", errParameterOutOfBounds, p.Name, v, min)
+		}
+		if max, err := strconv.ParseInt(p.Max, 10, 64); err == nil && v > max {
+			return fmt.Errorf("%w: %s: %d > %d", errParameterOutOfBounds, p.Name, v, max)
+		}
+
+	case ParameterTypeQuantity:
+		v, err := resource.ParseQuantity(value)
+		if err != nil {
+			return fmt.Errorf("%w: %s: %w", errParameterInvalidValue, p.Name, err)
+		}
+		if min, err := resource.ParseQuantity(p.Min); err == nil && v.Cmp(min) < 0 {
+			return fmt.Errorf("%w: %s: %s < %s", errParameterOutOfBounds, p.Name, value, p.Min)
+		}
+		if max, err := resource.ParseQuantity(p.Max); err == nil && v.Cmp(max) > 0 {
+			return fmt.Errorf("%w: %s: %s > %s", errParameterOutOfBounds, p.Name, value, p.Max)
+		}
+
+	default:
+		return fmt.Errorf("%w: %s: %s", errParameterInvalidType, p.Name, p.Type)
+	}
+
+	return nil
+}
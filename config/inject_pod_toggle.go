@@ -0,0 +1,31 @@
+package config
+
+import "hash"
+
+// InjectPodToggle is a boolean setting of the pod spec (for example
+// `shareProcessNamespace`).
+type InjectPodToggle struct {
+	Value bool `yaml:"value"`
+
+	// OnConflict defines what to do when the pod explicitly sets the value
+	// that is different from the injected one (default: the one of the rule)
+	OnConflict ConflictPolicy `yaml:"onConflict,omitempty"`
+}
+
+func (pt InjectPodToggle) hash(sum hash.Hash64) {
+	{ // value
+		sum.Write([]byte("value:"))
+		if pt.Value {
+			sum.Write([]byte{255})
+		} else {
+			sum.Write([]byte{0})
+		}
+		sum.Write([]byte{255})
+	}
+
+	{ // onConflict
+		if pt.OnConflict != "" {
+			pt.OnConflict.hash(sum)
+		}
+	}
+}
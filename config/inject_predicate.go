@@ -0,0 +1,271 @@
+package config
+
+import (
+	"errors"
+	"fmt"
+	"hash"
+	"strconv"
+
+	core_v1 "k8s.io/api/core/v1"
+)
+
+// InjectPredicate is the condition on the pod that is checked by the injector
+// itself (for the things that label selectors can not express).  Exactly one
+// of the fields must be set.  All patterns are regular expressions that must
+// match the whole string.
+type InjectPredicate struct {
+	// Image matches the images of the containers (not the init-containers)
+	Image *InjectPredicateImage `yaml:"image,omitempty"`
+
+	// ContainerName matches when any container or init-container of the pod
+	// has matching name
+	ContainerName string `yaml:"containerName,omitempty"`
+
+	// ServiceAccount matches the name of the service account of the pod
+	ServiceAccount string `yaml:"serviceAccount,omitempty"`
+
+	// HostNetwork matches the `hostNetwork` setting of the pod
+	HostNetwork *bool `yaml:"hostNetwork,omitempty"`
+
+	// OwnerKind matches when any of the owners of the pod has matching kind
+	OwnerKind string `yaml:"ownerKind,omitempty"`
+
+	// Label and Annotation match when the pod has the key (and, if the value
+	// pattern is set, when its value matches)
+	Label      *InjectPredicateKeyValue `yaml:"label,omitempty"`
+	Annotation *InjectPredicateKeyValue `yaml:"annotation,omitempty"`
+
+	// Not negates the nested predicate
+	Not *InjectPredicate `yaml:"not,omitempty"`
+}
+
+// InjectPredicateImage matches the images of the containers.
+type InjectPredicateImage struct {
+	Pattern string `yaml:"pattern,omitempty"`
+
+	// Containers is one of `any` (default), `all`, or `first`
+	Containers string `yaml:"containers,omitempty"`
+}
+
+type InjectPredicateKeyValue struct {
+	Key   string `yaml:"key,omitempty"`
+	Value string `yaml:"value,omitempty"`
+}
+
+const (
+	PredicateContainersAny   = "any"
+	PredicateContainersAll   = "all"
+	PredicateContainersFirst = "first"
+)
+
+var (
+	errPredicateEmpty             = errors.New("predicate must have a condition")
+	errPredicateInvalidContainers = errors.New("invalid containers of image predicate")
+	errPredicateMissingKey        = errors.New("predicate must have a key")
+	errPredicateMissingPattern    = errors.New("predicate must have a pattern")
+	errPredicateMultiple          = errors.New("predicate must have exactly one condition")
+)
+
+func (p InjectPredicate) hash(sum hash.Hash64) {
+	if p.Image != nil {
+		sum.Write([]byte("image:"))
+		sum.Write([]byte(p.Image.Pattern))
+		sum.Write([]byte{255})
+		sum.Write([]byte(p.Image.Containers))
+		sum.Write([]byte{255})
+	}
+
+	if p.ContainerName != "" {
+		sum.Write([]byte("containerName:"))
+		sum.Write([]byte(p.ContainerName))
+		sum.Write([]byte{255})
+	}
+
+	if p.ServiceAccount != "" {
+		sum.Write([]byte("serviceAccount:"))
+		sum.Write([]byte(p.ServiceAccount))
+		sum.Write([]byte{255})
+	}
+
+	if p.HostNetwork != nil {
+		sum.Write([]byte("hostNetwork:"))
+		sum.Write([]byte(strconv.FormatBool(*p.HostNetwork)))
+		sum.Write([]byte{255})
+	}
+
+	if p.OwnerKind != "" {
+		sum.Write([]byte("ownerKind:"))
+		sum.Write([]byte(p.OwnerKind))
+		sum.Write([]byte{255})
+	}
+
+	if p.Label != nil {
+		sum.Write([]byte("label:"))
+		p.Label.hash(sum)
+		sum.Write([]byte{255})
+	}
+
+	if p.Annotation != nil {
+		sum.Write([]byte("annotation:"))
+		p.Annotation.hash(sum)
+		sum.Write([]byte{255})
+	}
+
+	if p.Not != nil {
+		sum.Write([]byte("not:"))
+		p.Not.hash(sum)
+		sum.Write([]byte{255})
+	}
+}
+
+func (kv InjectPredicateKeyValue) hash(sum hash.Hash64) {
+	sum.Write([]byte("key:"))
+	sum.Write([]byte(kv.Key))
+	sum.Write([]byte{255})
+
+	sum.Write([]byte("value:"))
+	sum.Write([]byte(kv.Value))
+	sum.Write([]byte{255})
+}
+
+func (p InjectPredicate) Validate() error {
+	count := 0
+	for _, set := range []bool{
+		p.Image != nil,
+		p.ContainerName != "",
+		p.ServiceAccount != "",
+		p.HostNetwork != nil,
+		p.OwnerKind != "",
+		p.Label != nil,
+		p.Annotation != nil,
+		p.Not != nil,
+	} {
+		if set {
+			count++
+		}
+	}
+	switch count {
+	case 0:
+		return errPredicateEmpty
+	case 1:
+		// ok
+	default:
+		return errPredicateMultiple
+	}
+
+	patterns := []string{p.ContainerName, p.ServiceAccount, p.OwnerKind}
+
+	if p.Image != nil {
+		if p.Image.Pattern == "" {
+			return fmt.Errorf("%w: image", errPredicateMissingPattern)
+		}
+		switch p.Image.Containers {
+		case "", PredicateContainersAny, PredicateContainersAll, PredicateContainersFirst:
+		default:
+			return fmt.Errorf("%w: %s", errPredicateInvalidContainers, p.Image.Containers)
+		}
+		patterns = append(patterns, p.Image.Pattern)
+	}
+
+	for _, kv := range []*InjectPredicateKeyValue{p.Label, p.Annotation} {
+		if kv == nil {
+			continue
+		}
+		if kv.Key == "" {
+			return errPredicateMissingKey
+		}
+		patterns = append(patterns, kv.Value)
+	}
+
+	for _, pattern := range patterns {
+		if pattern == "" {
+			continue
+		}
+		if _, err := compilePattern(pattern); err != nil {
+			return err
+		}
+	}
+
+	if p.Not != nil {
+		return p.Not.Validate()
+	}
+
+	return nil
+}
+
+// Matches returns true if the pod satisfies the predicate.
+func (p InjectPredicate) Matches(pod *core_v1.Pod) bool {
+	switch {
+	case p.Image != nil:
+		switch p.Image.Containers {
+		case PredicateContainersFirst:
+			return len(pod.Spec.Containers) > 0 &&
+				matchesAny([]string{p.Image.Pattern}, pod.Spec.Containers[0].Image)
+		case PredicateContainersAll:
+			for _, c := range pod.Spec.Containers {
+				if !matchesAny([]string{p.Image.Pattern}, c.Image) {
+					return false
+				}
+			}
+			return len(pod.Spec.Containers) > 0
+		default:
+			for _, c := range pod.Spec.Containers {
+				if matchesAny([]string{p.Image.Pattern}, c.Image) {
+					return true
+				}
+			}
+			return false
+		}
+
+	case p.ContainerName != "":
+		for _, containers := range [][]core_v1.Container{pod.Spec.InitContainers, pod.Spec.Containers} {
+			for _, c := range containers {
+				if matchesAny([]string{p.ContainerName}, c.Name) {
+					return true
+				}
+			}
+		}
+		return false
+
+	case p.ServiceAccount != "":
+		serviceAccount := pod.Spec.ServiceAccountName
+		if serviceAccount == "" {
+			serviceAccount = "default"
+		}
+		return matchesAny([]string{p.ServiceAccount}, serviceAccount)
+
+	case p.HostNetwork != nil:
+		return pod.Spec.HostNetwork == *p.HostNetwork
+
+	case p.OwnerKind != "":
+		for _, owner := range pod.OwnerReferences {
+			if matchesAny([]string{p.OwnerKind}, owner.Kind) {
+				return true
+			}
+		}
+		return false
+
+	case p.Label != nil:
+		return p.Label.matches(pod.Labels)
+
+	case p.Annotation != nil:
+		return p.Annotation.matches(pod.Annotations)
+
+	case p.Not != nil:
+		return !p.Not.Matches(pod)
+	}
+
+	// empty predicates are rejected at startup (see `Validate`)
+	return false
+}
+
+func (kv InjectPredicateKeyValue) matches(m map[string]string) bool {
+	value, exists := m[kv.Key]
+	if !exists {
+		return false
+	}
+	if kv.Value == "" {
+		return true
+	}
+	return matchesAny([]string{kv.Value}, value)
+}
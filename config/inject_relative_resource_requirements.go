@@ -0,0 +1,198 @@
+package config
+
+import (
+	"errors"
+	"fmt"
+	"hash"
+	"math"
+	"unsafe"
+
+	core_v1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/api/resource"
+)
+
+// InjectRelativeResourceRequirements are the resources of the injected
+// container that are computed relative to the sum of resource requests of the
+// containers that the pod already has.
+type InjectRelativeResourceRequirements struct {
+	Limits   map[string]InjectRelativeQuantity `yaml:"limits,omitempty"`
+	Requests map[string]InjectRelativeQuantity `yaml:"requests,omitempty"`
+}
+
+// InjectRelativeQuantity is the percentage of the total that is clamped into
+// the [min, max] range.
+type InjectRelativeQuantity struct {
+	Percent float64 `yaml:"percent"`
+	Min     string  `yaml:"min,omitempty"`
+	Max     string  `yaml:"max,omitempty"`
+}
+
+var (
+	errRelativeQuantityInvalidPercent = errors.New("invalid percent of relative quantity")
+	errRelativeQuantityInvalidRange   = errors.New("invalid range of relative quantity")
+)
+
+func (rrr InjectRelativeResourceRequirements) hash(sum hash.Hash64) {
+	for _, list := range []struct {
+		name       string
+		quantities map[string]InjectRelativeQuantity
+	}{
+		{"limits", rrr.Limits},
+		{"requests", rrr.Requests},
+	} {
+		if len(list.quantities) > 0 {
+			sum.Write([]byte(list.name + ":"))
+			keys := make([]string, 0, len(list.quantities))
+			for k := range list.quantities {
+				keys = append(keys, k)
+			}
+			for _, k := range sortedKeysOf(keys) {
+				sum.Write([]byte("key:"))
+				sum.Write([]byte(k))
+				sum.Write([]byte{255})
+
+				sum.Write([]byte("value:"))
+				list.quantities[k].hash(sum)
+				sum.Write([]byte{255})
+			}
+			sum.Write([]byte{255})
+		}
+	}
+}
+
+func (rq InjectRelativeQuantity) hash(sum hash.Hash64) {
+	{ // percent
+		sum.Write([]byte("percent:"))
+		percent := math.Float64bits(rq.Percent)
+		sum.Write(unsafe.Slice(
+			(*byte)(unsafe.Pointer(&percent)),
+			unsafe.Sizeof(percent),
+		))
+		sum.Write([]byte{255})
+	}
+
+	{ // min
+		sum.Write([]byte("min:"))
+		sum.Write([]byte(rq.Min))
+		sum.Write([]byte{255})
+	}
+
+	{ // max
+		sum.Write([]byte("max:"))
+		sum.Write([]byte(rq.Max))
+		sum.Write([]byte{255})
+	}
+}
+
+// Validate makes sure that percent is positive and that the range is valid
+func (rq InjectRelativeQuantity) Validate() error {
+	if rq.Percent <= 0 || math.IsInf(rq.Percent, 0) || math.IsNaN(rq.Percent) {
+		return fmt.Errorf("%w: %v", errRelativeQuantityInvalidPercent, rq.Percent)
+	}
+
+	var min, max *resource.Quantity
+	if rq.Min != "" {
+		q, err := resource.ParseQuantity(rq.Min)
+		if err != nil {
+			return fmt.Errorf("%w: %s: %w", errRelativeQuantityInvalidRange, rq.Min, err)
+		}
+		min = &q
+	}
+	if rq.Max != "" {
+		q, err := resource.ParseQuantity(rq.Max)
+		if err != nil {
+			return fmt.Errorf("%w: %s: %w", errRelativeQuantityInvalidRange, rq.Max, err)
+		}
+		max = &q
+	}
+	if min != nil && max != nil && min.Cmp(*max) > 0 {
+		return fmt.Errorf("%w: %s > %s", errRelativeQuantityInvalidRange, rq.Min, rq.Max)
+	}
+
+	return nil
+}
+
+// Quantity returns the percentage of the total clamped into the range.  The
+// zero-quantity is returned as nil.
+func (rq InjectRelativeQuantity) Quantity(name core_v1.ResourceName, total resource.Quantity) (*resource.Quantity, error) {
+	format := total.Format
+	if format == "" {
+		format = resource.DecimalSI
+	}
+
+	var res *resource.Quantity
+	if name == core_v1.ResourceCPU {
+		res = resource.NewMilliQuantity(int64(float64(total.MilliValue())*rq.Percent/100), format)
+	} else {
+		res = resource.NewQuantity(int64(float64(total.Value())*rq.Percent/100), format)
+	}
+
+	if rq.Min != "" {
+		min, err := resource.ParseQuantity(rq.Min)
+		if err != nil {
+			return nil, err
+		}
+		if res.Cmp(min) < 0 {
+			res = &min
+		}
+	}
+
+	if rq.Max != "" {
+		max, err := resource.ParseQuantity(rq.Max)
+		if err != nil {
+			return nil, err
+		}
+		if res.Cmp(max) > 0 {
+			res = &max
+		}
+	}
+
+	if res.IsZero() {
+		return nil, nil
+	}
+
+	return res, nil
+}
+
+// ResourceRequirements computes the resources relative to the sum of resource
+// requests of the pod's containers.
+func (rrr InjectRelativeResourceRequirements) ResourceRequirements(pod *core_v1.Pod) (*core_v1.ResourceRequirements, error) {
+	total := make(map[core_v1.ResourceName]resource.Quantity)
+	for _, c := range pod.Spec.Containers {
+		for name, q := range c.Resources.Requests {
+			t := total[name]
+			t.Add(q)
+			total[name] = t
+		}
+	}
+
+	compute := func(relative map[string]InjectRelativeQuantity) (core_v1.ResourceList, error) {
+		res := make(core_v1.ResourceList, len(relative))
+		for k, rq := range relative {
+			name := core_v1.ResourceName(k)
+			q, err := rq.Quantity(name, total[name])
+			if err != nil {
+				return nil, fmt.Errorf("%w: %s", err, k)
+			}
+			if q != nil {
+				res[name] = *q
+			}
+		}
+		return res, nil
+	}
+
+	limits, err := compute(rrr.Limits)
+	if err != nil {
+		return nil, err
+	}
+
+	requests, err := compute(rrr.Requests)
+	if err != nil {
+		return nil, err
+	}
+
+	return &core_v1.ResourceRequirements{
+		Limits:   limits,
+		Requests: requests,
+	}, nil
+}
@@ -0,0 +1,73 @@
+package config
+
+import (
+	"errors"
+	"fmt"
+	"hash"
+	"hash/fnv"
+	"strconv"
+)
+
+// InjectRollout limits the rule to the share of the workloads (for the canary
+// rollouts of the new sidecars).
+type InjectRollout struct {
+	// Percentage of the workloads that the rule applies to
+	Percentage int `yaml:"percentage,omitempty"`
+
+	// Namespaces always receive the rule regardless of the percentage
+	Namespaces []string `yaml:"namespaces,omitempty"`
+}
+
+var (
+	errRolloutInvalidPercentage = errors.New("rollout percentage must be within [0, 100]")
+)
+
+func (r InjectRollout) hash(sum hash.Hash64) {
+	{ // percentage
+		sum.Write([]byte("percentage:"))
+		sum.Write([]byte(strconv.Itoa(r.Percentage)))
+		sum.Write([]byte{255})
+	}
+
+	{ // namespaces
+		if len(r.Namespaces) > 0 {
+			sum.Write([]byte("namespaces:"))
+			for _, ns := range sortedKeysOf(append([]string(nil), r.Namespaces...)) {
+				sum.Write([]byte(ns))
+				sum.Write([]byte{255})
+			}
+			sum.Write([]byte{255})
+		}
+	}
+}
+
+func (r InjectRollout) Validate() error {
+	if r.Percentage < 0 || r.Percentage > 100 {
+		return fmt.Errorf("%w: %d", errRolloutInvalidPercentage, r.Percentage)
+	}
+	return nil
+}
+
+// Bucket returns the bucket ([0, 100)) of the workload.  All pods of the same
+// workload fall into the same bucket.  The salt (the name of the rule) makes
+// different rules pick different workloads for their canaries.
+func (r InjectRollout) Bucket(salt, namespace, owner string) int {
+	sum := fnv.New32a()
+	sum.Write([]byte(salt))
+	sum.Write([]byte{255})
+	sum.Write([]byte(namespace))
+	sum.Write([]byte{255})
+	sum.Write([]byte(owner))
+	return int(sum.Sum32() % 100)
+}
+
+// Selects returns true if the workload in the namespace (and in the bucket)
+// receives the rule.
+func (r InjectRollout) Selects(namespace string, bucket int) bool {
+	for _, ns := range r.Namespaces {
+		if ns == namespace {
+			return true
+		}
+	}
+	return bucket < r.Percentage
+}
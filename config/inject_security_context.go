@@ -0,0 +1,131 @@
+package config
+
+import (
+	"hash"
+	"unsafe"
+
+	core_v1 "k8s.io/api/core/v1"
+)
+
+type InjectSecurityContext struct {
+	AllowPrivilegeEscalation *bool                 `yaml:"allowPrivilegeEscalation,omitempty"`
+	Capabilities             *InjectCapabilities   `yaml:"capabilities,omitempty"`
+	Privileged               *bool                 `yaml:"privileged,omitempty"`
+	ReadOnlyRootFilesystem   *bool                 `yaml:"readOnlyRootFilesystem,omitempty"`
+	RunAsGroup               *int64                `yaml:"runAsGroup,omitempty"`
+	RunAsNonRoot             *bool                 `yaml:"runAsNonRoot,omitempty"`
+	RunAsUser                *int64                `yaml:"runAsUser,omitempty"`
+	SeccompProfile           *InjectSeccompProfile `yaml:"seccompProfile,omitempty"`
+}
+
+type InjectCapabilities struct {
+	Add  []string `yaml:"add,omitempty"`
+	Drop []string `yaml:"drop,omitempty"`
+}
+
+type InjectSeccompProfile struct {
+	Type             string  `yaml:"type"`
+	LocalhostProfile *string `yaml:"localhostProfile,omitempty"`
+}
+
+func (sc InjectSecurityContext) hash(sum hash.Hash64) {
+	hashBool := func(name string, b *bool) {
+		if b != nil {
+			sum.Write([]byte(name + ":"))
+			if *b {
+				sum.Write([]byte{255})
+			} else {
+				sum.Write([]byte{0})
+			}
+			sum.Write([]byte{255})
+		}
+	}
+
+	hashInt64 := func(name string, i *int64) {
+		if i != nil {
+			sum.Write([]byte(name + ":"))
+			sum.Write(unsafe.Slice(
+				(*byte)(unsafe.Pointer(i)),
+				unsafe.Sizeof(*i),
+			))
+			sum.Write([]byte{255})
+		}
+	}
+
+	hashBool("allowPrivilegeEscalation", sc.AllowPrivilegeEscalation)
+
+	{ // capabilities
+		if sc.Capabilities != nil {
+			sum.Write([]byte("capabilities:"))
+			if len(sc.Capabilities.Add) > 0 {
+				sum.Write([]byte("add:"))
+				for _, c := range sc.Capabilities.Add {
+					sum.Write([]byte(c))
+					sum.Write([]byte{255})
+				}
+				sum.Write([]byte{255})
+			}
+			if len(sc.Capabilities.Drop) > 0 {
+				sum.Write([]byte("drop:"))
+				for _, c := range sc.Capabilities.Drop {
+					sum.Write([]byte(c))
+					sum.Write([]byte{255})
+				}
+				sum.Write([]byte{255})
+			}
+			sum.Write([]byte{255})
+		}
+	}
+
+	hashBool("privileged", sc.Privileged)
+	hashBool("readOnlyRootFilesystem", sc.ReadOnlyRootFilesystem)
+	hashInt64("runAsGroup", sc.RunAsGroup)
+	hashBool("runAsNonRoot", sc.RunAsNonRoot)
+	hashInt64("runAsUser", sc.RunAsUser)
+
+	{ // seccompProfile
+		if sc.SeccompProfile != nil {
+			sum.Write([]byte("seccompProfile:"))
+			sum.Write([]byte("type:"))
+			sum.Write([]byte(sc.SeccompProfile.Type))
+			sum.Write([]byte{255})
+			if sc.SeccompProfile.LocalhostProfile != nil {
+				sum.Write([]byte("localhostProfile:"))
+				sum.Write([]byte(*sc.SeccompProfile.LocalhostProfile))
+				sum.Write([]byte{255})
+			}
+			sum.Write([]byte{255})
+		}
+	}
+}
+
+func (sc InjectSecurityContext) SecurityContext() (*core_v1.SecurityContext, error) {
+	res := &core_v1.SecurityContext{
+		AllowPrivilegeEscalation: sc.AllowPrivilegeEscalation,
+		Privileged:               sc.Privileged,
+		ReadOnlyRootFilesystem:   sc.ReadOnlyRootFilesystem,
+		RunAsGroup:               sc.RunAsGroup,
+		RunAsNonRoot:             sc.RunAsNonRoot,
+		RunAsUser:                sc.RunAsUser,
+	}
+
+	if sc.Capabilities != nil {
+		capabilities := &core_v1.Capabilities{}
+		for _, c := range sc.Capabilities.Add {
+			capabilities.Add = append(capabilities.Add, core_v1.Capability(c))
+		}
+		for _, c := range sc.Capabilities.Drop {
+			capabilities.Drop = append(capabilities.Drop, core_v1.Capability(c))
+		}
+		res.Capabilities = capabilities
+	}
+
+	if sc.SeccompProfile != nil {
+		res.SeccompProfile = &core_v1.SeccompProfile{
+			Type:             core_v1.SeccompProfileType(sc.SeccompProfile.Type),
+			LocalhostProfile: sc.SeccompProfile.LocalhostProfile,
+		}
+	}
+
+	return res, nil
+}
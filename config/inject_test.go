@@ -0,0 +1,211 @@
+package config
+
+import (
+	"errors"
+	"testing"
+
+	core_v1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/api/resource"
+)
+
+func testInject() Inject {
+	return Inject{
+		Name: "test",
+
+		LabelSelector: &InjectLabelSelector{
+			MatchLabels: map[string]string{
+				"app.kubernetes.io/name":      "app",
+				"app.kubernetes.io/instance":  "app-1",
+				"app.kubernetes.io/component": "server",
+			},
+		},
+
+		Annotations: map[string]string{"a": "1", "b": "2", "c": "3", "d": "4"},
+		Labels:      map[string]string{"e": "5", "f": "6", "g": "7", "h": "8"},
+
+		Containers: []InjectContainer{{
+			Name:  "sidecar",
+			Image: "sidecar:latest",
+			Ports: []InjectContainerPort{{
+				Name:          "metrics",
+				ContainerPort: 8080,
+			}},
+			Resources: &InjectContainerResourceRequirements{
+				Limits:   map[string]string{"cpu": "100m", "memory": "128Mi", "ephemeral-storage": "1Gi"},
+				Requests: map[string]string{"cpu": "10m", "memory": "64Mi", "ephemeral-storage": "100Mi"},
+			},
+		}},
+	}
+}
+
+// TestInjectFingerprintGolden pins the fingerprints down, as these name the
+// webhooks (the change re-registers all of them on the upgrade).
+func TestInjectFingerprintGolden(t *testing.T) {
+	withHostPort := testInject()
+	withHostPort.Containers[0].Ports[0].HostPort = 8080
+
+	withNative := testInject()
+	withNative.Native = &InjectNative{
+		Containers: []core_v1.Container{{
+			Name:  "native",
+			Image: "native:latest",
+			Env: []core_v1.EnvVar{
+				{Name: "A", Value: "1"},
+			},
+			Resources: core_v1.ResourceRequirements{
+				Limits: core_v1.ResourceList{
+					core_v1.ResourceCPU:    resource.MustParse("100m"),
+					core_v1.ResourceMemory: resource.MustParse("128Mi"),
+				},
+			},
+		}},
+	}
+
+	for _, tc := range []struct {
+		name        string
+		inject      Inject
+		fingerprint string
+	}{
+		{"plain", testInject(), "0aedfc332d960170"},
+		{"hostPort", withHostPort, "eb6f5a3097e8635b"},
+		{"native", withNative, "f279f82c8a5f8191"},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			if got := tc.inject.Fingerprint(); got != tc.fingerprint {
+				t.Errorf("unexpected fingerprint: got %s, want %s", got, tc.fingerprint)
+			}
+		})
+	}
+}
+
+func TestInjectFingerprintIsStable(t *testing.T) {
+	// go randomises the iteration order of the maps => repeat enough times
+	// for the unsorted iteration to show up
+	expected := testInject().Fingerprint()
+	for range 100 {
+		if got := testInject().Fingerprint(); got != expected {
+			t.Fatalf("fingerprint changed between the runs: got %s, want %s", got, expected)
+		}
+	}
+}
+
+func TestInjectFingerprintHostPort(t *testing.T) {
+	i := testInject()
+	expected := i.Fingerprint()
+
+	i.Containers[0].Ports[0].HostPort = 8080
+	if got := i.Fingerprint(); got == expected {
+		t.Errorf("fingerprint does not change with the host port: %s", got)
+	}
+}
+
+func TestInjectFingerprintNative(t *testing.T) {
+	native := func(value string) Inject {
+		i := testInject()
+		i.Native = &InjectNative{
+			Containers: []core_v1.Container{{
+				Name:  "native",
+				Image: "native:latest",
+				Env:   []core_v1.EnvVar{{Name: "A", Value: value}},
+			}},
+		}
+		return i
+	}
+
+	if native("1").Fingerprint() != native("1").Fingerprint() {
+		t.Errorf("fingerprint of the same native container differs")
+	}
+	if native("1").Fingerprint() == native("2").Fingerprint() {
+		t.Errorf("fingerprint does not change with the native container")
+	}
+	if native("1").Fingerprint() == testInject().Fingerprint() {
+		t.Errorf("fingerprint does not change with the native containers")
+	}
+}
+
+func TestInjectValidate(t *testing.T) {
+	for _, tc := range []struct {
+		name   string
+		modify func(i *Inject)
+		err    error
+	}{
+		{"plain", func(i *Inject) {}, nil},
+		{"invalidConflictPolicy", func(i *Inject) {
+			i.Containers[0].OnConflict = "replace"
+		}, errConflictPolicyInvalid},
+		{"optInWithoutName", func(i *Inject) {
+			i.Name, i.OptIn = "", true
+		}, errInjectWithoutName},
+		{"optInInvalidAnnotation", func(i *Inject) {
+			i.Name, i.OptIn = "not/valid", true
+		}, errInjectInvalidAnnotation},
+		{"onDemandWithoutName", func(i *Inject) {
+			i.Name, i.OnDemand = "", true
+		}, errInjectWithoutName},
+		{"onDemandInvalidName", func(i *Inject) {
+			i.Name, i.OnDemand = "a,b", true
+		}, errInjectInvalidOnDemandName},
+		{"onDemandWorkloads", func(i *Inject) {
+			i.OnDemand, i.Workloads = true, true
+		}, errInjectOnDemandWorkloads},
+		{"onDemandMatchConditions", func(i *Inject) {
+			i.OnDemand = true
+			i.MatchConditions = []InjectMatchCondition{{Name: "a", Expression: "true"}}
+		}, errInjectOnDemandMatchConditions},
+		{"matchConditionsOfWorkloads", func(i *Inject) {
+			i.Workloads = true
+			i.MatchConditions = []InjectMatchCondition{{Name: "a", Expression: "true"}}
+		}, errInjectMatchConditionsOfWorkloads},
+		{"emptyPredicate", func(i *Inject) {
+			i.When = []InjectPredicate{{}}
+		}, errPredicateEmpty},
+		{"emptyOwnerKind", func(i *Inject) {
+			i.OwnerKinds = &InjectOwnerKinds{Include: []string{" "}}
+		}, errOwnerKindsEmptyKind},
+		{"invalidOperation", func(i *Inject) {
+			i.Operations = InjectOperations{"DELETE"}
+		}, errOperationsInvalid},
+		{"invalidRollout", func(i *Inject) {
+			i.Rollout = &InjectRollout{Percentage: 101}
+		}, errRolloutInvalidPercentage},
+		{"parametersWithoutName", func(i *Inject) {
+			i.Name = ""
+			i.Parameters = []InjectParameter{{Name: "a"}}
+		}, errInjectWithoutName},
+		{"invalidRelativeResource", func(i *Inject) {
+			i.Containers[0].Resources.Relative = &InjectRelativeResourceRequirements{
+				Limits: map[string]InjectRelativeQuantity{"cpu": {Percent: 0}},
+			}
+		}, errRelativeQuantityInvalidPercent},
+		{"invalidToggle", func(i *Inject) {
+			i.HostPID = &InjectPodToggle{Value: true, OnConflict: "replace"}
+		}, errConflictPolicyInvalid},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			i := testInject()
+			tc.modify(&i)
+			err := i.Validate()
+			switch {
+			case tc.err == nil && err != nil:
+				t.Errorf("unexpected error: %v", err)
+			case tc.err != nil && !errors.Is(err, tc.err):
+				t.Errorf("unexpected error: got %v, want %v", err, tc.err)
+			}
+		})
+	}
+}
+
+func TestValidateInjectsDuplicateOnDemandName(t *testing.T) {
+	onDemand := func(name string) *Inject {
+		i := testInject()
+		i.Name, i.OnDemand = name, true
+		return &i
+	}
+
+	if err := ValidateInjects([]*Inject{onDemand("a"), onDemand("b")}); err != nil {
+		t.Errorf("unexpected error: %v", err)
+	}
+	if err := ValidateInjects([]*Inject{onDemand("a"), onDemand("a")}); !errors.Is(err, errInjectDuplicateOnDemandName) {
+		t.Errorf("unexpected error: got %v, want %v", err, errInjectDuplicateOnDemandName)
+	}
+}
@@ -13,6 +13,10 @@ type InjectToleration struct {
 	Value             string `yaml:"value,omitempty"`
 	Effect            string `yaml:"effect,omitempty"`
 	TolerationSeconds *int64 `yaml:"tolerationSeconds,omitempty"`
+
+	// OnConflict defines what to do when the pod already has the
+	// toleration with the same key and effect (default: the one of the rule)
+	OnConflict ConflictPolicy `yaml:"onConflict,omitempty"`
 }
 
 func (t InjectToleration) hash(sum hash.Hash64) {
@@ -50,6 +54,12 @@ func (t InjectToleration) hash(sum hash.Hash64) {
 			sum.Write([]byte{255})
 		}
 	}
+
+	{ // onConflict
+		if t.OnConflict != "" {
+			t.OnConflict.hash(sum)
+		}
+	}
 }
 
 func (t InjectToleration) Toleration() (*core_v1.Toleration, error) {
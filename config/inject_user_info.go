@@ -0,0 +1,120 @@
+package config
+
+import (
+	"fmt"
+	"hash"
+	"path"
+	"strings"
+
+	authentication_v1 "k8s.io/api/authentication/v1"
+)
+
+// InjectUserInfo limits the rule to the admission requests by the identity
+// that makes them.
+//
+// A request is selected when it matches the include-matcher (or when there is
+// none) and does not match the exclude-matcher.
+type InjectUserInfo struct {
+	Include *InjectUserInfoMatcher `yaml:"include,omitempty"`
+	Exclude *InjectUserInfoMatcher `yaml:"exclude,omitempty"`
+}
+
+// InjectUserInfoMatcher matches when any of its patterns matches.  Patterns
+// are globs (see https://pkg.go.dev/path#Match).
+type InjectUserInfoMatcher struct {
+	Usernames []string `yaml:"usernames,omitempty"`
+	Groups    []string `yaml:"groups,omitempty"`
+
+	// ServiceAccounts are matched as `<namespace>/<name>`
+	ServiceAccounts []string `yaml:"serviceAccounts,omitempty"`
+}
+
+const (
+	serviceAccountUsernamePrefix = "system:serviceaccount:"
+)
+
+func (ui InjectUserInfo) hash(sum hash.Hash64) {
+	if ui.Include != nil {
+		sum.Write([]byte("include:"))
+		ui.Include.hash(sum)
+		sum.Write([]byte{255})
+	}
+
+	if ui.Exclude != nil {
+		sum.Write([]byte("exclude:"))
+		ui.Exclude.hash(sum)
+		sum.Write([]byte{255})
+	}
+}
+
+func (m InjectUserInfoMatcher) hash(sum hash.Hash64) {
+	for _, list := range []struct {
+		name     string
+		patterns []string
+	}{
+		{"usernames", m.Usernames},
+		{"groups", m.Groups},
+		{"serviceAccounts", m.ServiceAccounts},
+	} {
+		if len(list.patterns) > 0 {
+			sum.Write([]byte(list.name + ":"))
+			for _, p := range list.patterns {
+				sum.Write([]byte(p))
+				sum.Write([]byte{255})
+			}
+			sum.Write([]byte{255})
+		}
+	}
+}
+
+// Validate makes sure that all patterns are valid globs
+func (ui InjectUserInfo) Validate() error {
+	for _, m := range []*InjectUserInfoMatcher{ui.Include, ui.Exclude} {
+		if m == nil {
+			continue
+		}
+		for _, patterns := range [][]string{m.Usernames, m.Groups, m.ServiceAccounts} {
+			for _, p := range patterns {
+				if _, err := path.Match(p, ""); err != nil {
+					return fmt.Errorf("%w: %s", err, p)
+				}
+			}
+		}
+	}
+	return nil
+}
+
+// Matches returns true if the request by the user is selected
+func (ui InjectUserInfo) Matches(user *authentication_v1.UserInfo) bool {
+	if ui.Include != nil && !ui.Include.matches(user) {
+		return false
+	}
+	return ui.Exclude == nil || !ui.Exclude.matches(user)
+}
+
+func (m InjectUserInfoMatcher) matches(user *authentication_v1.UserInfo) bool {
+	if matchesAnyGlob(m.Usernames, user.Username) {
+		return true
+	}
+	for _, g := range user.Groups {
+		if matchesAnyGlob(m.Groups, g) {
+			return true
+		}
+	}
+	if serviceAccount, ok := strings.CutPrefix(user.Username, serviceAccountUsernamePrefix); ok {
+		// system:serviceaccount:<namespace>:<name>
+		if namespace, name, ok := strings.Cut(serviceAccount, ":"); ok {
+			return matchesAnyGlob(m.ServiceAccounts, namespace+"/"+name)
+		}
+	}
+	return false
+}
+
+func matchesAnyGlob(patterns []string, s string) bool {
+	for _, p := range patterns {
+		if matched, err := path.Match(p, s); err == nil && matched {
+			return true
+		}
+	}
+	return false
+}
@@ -10,6 +10,10 @@ type InjectVolume struct {
 	Name string `yaml:"name,omitempty"`
 
 	ConfigMap *InjectVolumeConfigMap `yaml:"configMap,omitempty"`
+
+	// OnConflict defines what to do when the pod already has the
+	// volume with the same name (default: the one of the rule)
+	OnConflict ConflictPolicy `yaml:"onConflict,omitempty"`
 }
 
 func (v InjectVolume) hash(sum hash.Hash64) {
@@ -22,6 +26,10 @@ func (v InjectVolume) hash(sum hash.Hash64) {
 		v.ConfigMap.hash(sum)
 		sum.Write([]byte{255})
 	}
+
+	if v.OnConflict != "" {
+		v.OnConflict.hash(sum)
+	}
 }
 
 func (v InjectVolume) Volume() (*core_v1.Volume, error) {
@@ -17,6 +17,14 @@ type InjectVolumeMount struct {
 	RecursiveReadOnly *string `yaml:"recursiveReadOnly,omitempty"`
 
 	MountPropagation *string `yaml:"mountPropagation,omitempty"`
+
+	// Containers limits the containers of the pod that the volume is mounted
+	// into (only applies to the volume mounts of the inject rule itself)
+	Containers *InjectContainerSelector `yaml:"containers,omitempty"`
+
+	// OnConflict defines what to do when the pod already has the
+	// volume mount at the same path (default: the one of the rule)
+	OnConflict ConflictPolicy `yaml:"onConflict,omitempty"`
 }
 
 func (vm InjectVolumeMount) hash(sum hash.Hash64) {
@@ -69,6 +77,20 @@ func (vm InjectVolumeMount) hash(sum hash.Hash64) {
 			sum.Write([]byte{255})
 		}
 	}
+
+	{ // containers
+		if vm.Containers != nil {
+			sum.Write([]byte("containers:"))
+			vm.Containers.hash(sum)
+			sum.Write([]byte{255})
+		}
+	}
+
+	{ // onConflict
+		if vm.OnConflict != "" {
+			vm.OnConflict.hash(sum)
+		}
+	}
 }
 
 func (vm InjectVolumeMount) VolumeMount() (*core_v1.VolumeMount, error) {
@@ -5,4 +5,16 @@ type K8S struct {
 	ServiceName                      string `yaml:"serviceName,omitempty"`
 	ServicePortNumber                int32  `yaml:"servicePortNumber,omitempty"`
 	MutatingWebhookConfigurationName string `yaml:"mutatingWebhookConfigurationName,omitempty"`
+
+	// DisableMatchConditions leaves match conditions out of the webhooks (for
+	// the clusters that do not support them)
+	DisableMatchConditions bool `yaml:"disableMatchConditions,omitempty"`
+
+	// DisableDefaultExclusions lets the webhooks match the injector's own
+	// namespace, kube-system, and the injector's own pods
+	DisableDefaultExclusions bool `yaml:"disableDefaultExclusions,omitempty"`
+
+	// DisableNamespaceAnnotations ignores the inject annotations of the
+	// namespaces (so that the injector does not need to watch them)
+	DisableNamespaceAnnotations bool `yaml:"disableNamespaceAnnotations,omitempty"`
 }
@@ -3,5 +3,6 @@ package config
 type Server struct {
 	ListenAddress   string `yaml:"listenAddress,omitempty"`
 	PathHealthcheck string `yaml:"patchHealthcheck,omitempty"`
+	PathMetrics     string `yaml:"pathMetrics,omitempty"`
 	PathWebhook     string `yaml:"patchWebhook,omitempty"`
 }
@@ -0,0 +1,128 @@
+// Package fargate estimates the capacity that AWS EKS Fargate provisions (and
+// bills) for the pod.
+//
+// See: https://docs.aws.amazon.com/eks/latest/userguide/fargate-pod-configuration.html
+package fargate
+
+import (
+	"errors"
+	"fmt"
+	"strconv"
+
+	core_v1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/api/resource"
+)
+
+// Capacity is the vCPU and memory combination provisioned for the pod
+type Capacity struct {
+	MilliCPU  int64
+	MemoryMiB int64
+}
+
+var (
+	ErrCapacityExceeded = errors.New("pod exceeds the largest fargate capacity")
+)
+
+const (
+	// kubernetesComponentsMemoryMiB is the memory that fargate reserves on
+	// top of pod's own requests for the k8s components (kubelet etc.)
+	kubernetesComponentsMemoryMiB = 256
+)
+
+// configurations are the vCPU and memory combinations supported by EKS
+// Fargate (from the smallest to the largest)
+var configurations = []struct {
+	milliCPU  int64
+	memoryMiB []int64
+}{
+	{250, []int64{512, 1024, 2048}},
+	{500, gibRange(1, 4)},
+	{1000, gibRange(2, 8)},
+	{2000, gibRange(4, 16)},
+	{4000, gibRange(8, 30)},
+}
+
+func gibRange(from, to int64) []int64 {
+	res := make([]int64, 0, to-from+1)
+	for gib := from; gib <= to; gib++ {
+		res = append(res, gib*1024)
+	}
+	return res
+}
+
+func (c Capacity) String() string {
+	return fmt.Sprintf("%svCPU %sGB",
+		strconv.FormatFloat(float64(c.MilliCPU)/1000, 'f', -1, 64),
+		strconv.FormatFloat(float64(c.MemoryMiB)/1024, 'f', -1, 64),
+	)
+}
+
+// PodCapacity returns the smallest fargate capacity that fits the pod.
+//
+// The pod's requirement is the largest of: the request of any init-container,
+// or the sum of the requests of long-running containers (including the
+// native sidecars).  When the request is not specified, the limit is used
+// (which is what k8s does as well).
+func PodCapacity(spec *core_v1.PodSpec) (*Capacity, error) {
+	var (
+		cpu    resource.Quantity
+		memory resource.Quantity
+
+		initCPU    resource.Quantity
+		initMemory resource.Quantity
+	)
+
+	for _, c := range spec.InitContainers {
+		if c.RestartPolicy != nil && *c.RestartPolicy == core_v1.ContainerRestartPolicyAlways {
+			cpu.Add(request(c, core_v1.ResourceCPU))
+			memory.Add(request(c, core_v1.ResourceMemory))
+			continue
+		}
+		if q := request(c, core_v1.ResourceCPU); q.Cmp(initCPU) > 0 {
+			initCPU = q
+		}
+		if q := request(c, core_v1.ResourceMemory); q.Cmp(initMemory) > 0 {
+			initMemory = q
+		}
+	}
+
+	for _, c := range spec.Containers {
+		cpu.Add(request(c, core_v1.ResourceCPU))
+		memory.Add(request(c, core_v1.ResourceMemory))
+	}
+
+	if initCPU.Cmp(cpu) > 0 {
+		cpu = initCPU
+	}
+	if initMemory.Cmp(memory) > 0 {
+		memory = initMemory
+	}
+
+	milliCPU := cpu.MilliValue()
+	memoryMiB := (memory.Value()+1024*1024-1)/(1024*1024) + kubernetesComponentsMemoryMiB
+
+	for _, c := range configurations {
+		if c.milliCPU < milliCPU {
+			continue
+		}
+		for _, m := range c.memoryMiB {
+			if m >= memoryMiB {
+				return &Capacity{MilliCPU: c.milliCPU, MemoryMiB: m}, nil
+			}
+		}
+	}
+
+	return nil, fmt.Errorf("%w: %dm vCPU %dMi memory",
+		ErrCapacityExceeded, milliCPU, memoryMiB,
+	)
+}
+
+func request(c core_v1.Container, name core_v1.ResourceName) resource.Quantity {
+	if q, found := c.Resources.Requests[name]; found {
+		return q
+	}
+	if q, found := c.Resources.Limits[name]; found {
+		return q
+	}
+	return resource.Quantity{}
+}
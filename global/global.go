@@ -3,4 +3,8 @@ package global
 const (
 	AppName   = "kube-sidecar-injector"
 	OrgDomain = "flashbots.net"
+
+	// AnnotationPrefix is the prefix of the annotations that pods can use to
+	// control the injection
+	AnnotationPrefix = "sidecar." + OrgDomain + "/"
 )
@@ -61,3 +61,28 @@ func Replace(path string, value interface{}) (
 		"value": &rawValue,
 	}, nil
 }
+
+// Prefix returns the copy of the operation with its path moved under the
+// prefix (json pointer).
+func Prefix(op json_patch.Operation, prefix string) (
+	json_patch.Operation, error,
+) {
+	path, err := op.Path()
+	if err != nil {
+		return nil, err
+	}
+
+	bytesPath, err := json.Marshal(prefix + path)
+	if err != nil {
+		return nil, err
+	}
+	rawPath := json.RawMessage(bytesPath)
+
+	res := make(json_patch.Operation, len(op))
+	for k, v := range op {
+		res[k] = v
+	}
+	res["path"] = &rawPath
+
+	return res, nil
+}
@@ -0,0 +1,148 @@
+package patch
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"reflect"
+
+	"github.com/flashbots/kube-sidecar-injector/config"
+)
+
+var (
+	// ErrConflict is returned when the injected element collides with the
+	// existing one, and the conflict policy is `fail`
+	ErrConflict = errors.New("conflict")
+)
+
+// Conflict describes the collision of the injected element with the one that
+// the pod already has, and how it was resolved.
+type Conflict struct {
+	Element   string // volume, volumeMount, container, toleration, label, annotation, toggle
+	Name      string
+	Container string // only for volume mounts
+
+	Policy config.ConflictPolicy
+
+	// Identical is set when the existing element already is the injected one
+	// (for example, when the webhook sees its own output on reinvocation), in
+	// which case there is nothing to resolve, and the element is left as is
+	Identical bool
+}
+
+func errConflict(element, name string) error {
+	return fmt.Errorf("%w: %s '%s' already exists in the pod",
+		ErrConflict, element, name,
+	)
+}
+
+// scalarPolicy resolves the policy for the collision of the scalar values (a
+// label, an annotation, or a toggle).  There is nothing to merge in these, so
+// `merge` falls back to `skip` (the existing value wins).
+func scalarPolicy(policy config.ConflictPolicy) config.ConflictPolicy {
+	if policy == config.ConflictPolicyMerge {
+		return config.ConflictPolicySkip
+	}
+	return policy
+}
+
+// identical returns true if the existing element is the same as the injected
+// one.  The fields that the injected element leaves unset are not compared, as
+// k8s api-server fills them in with the defaults.
+func identical[T any](existing, injected T) (bool, error) {
+	_existing, err := toMap(existing)
+	if err != nil {
+		return false, err
+	}
+	_injected, err := toMap(injected)
+	if err != nil {
+		return false, err
+	}
+	return covers(_existing, _injected), nil
+}
+
+// covers returns true if all values that are set in the injected element are
+// equal to the ones of the existing element.
+func covers(existing, injected interface{}) bool {
+	switch _injected := injected.(type) {
+	case map[string]interface{}:
+		_existing, ok := existing.(map[string]interface{})
+		if !ok {
+			return false
+		}
+		for k, i := range _injected {
+			e, exists := _existing[k]
+			if !exists || !covers(e, i) {
+				return false
+			}
+		}
+		return true
+	case []interface{}:
+		_existing, ok := existing.([]interface{})
+		if !ok || len(_existing) != len(_injected) {
+			return false
+		}
+		for idx := range _injected {
+			if !covers(_existing[idx], _injected[idx]) {
+				return false
+			}
+		}
+		return true
+	default:
+		return reflect.DeepEqual(existing, injected)
+	}
+}
+
+// merge fills in the fields that are not set in the existing element with the
+// ones from the injected element (the values that are set in both are kept
+// as they are in the existing element).
+func merge[T any](existing, injected T) (T, error) {
+	var res T
+
+	_existing, err := toMap(existing)
+	if err != nil {
+		return res, err
+	}
+	_injected, err := toMap(injected)
+	if err != nil {
+		return res, err
+	}
+
+	b, err := json.Marshal(mergeMaps(_existing, _injected))
+	if err != nil {
+		return res, err
+	}
+	if err := json.Unmarshal(b, &res); err != nil {
+		return res, err
+	}
+
+	return res, nil
+}
+
+func toMap(v interface{}) (map[string]interface{}, error) {
+	b, err := json.Marshal(v)
+	if err != nil {
+		return nil, err
+	}
+	var res map[string]interface{}
+	if err := json.Unmarshal(b, &res); err != nil {
+		return nil, err
+	}
+	return res, nil
+}
+
+func mergeMaps(dst, src map[string]interface{}) map[string]interface{} {
+	for k, s := range src {
+		d, exists := dst[k]
+		if !exists {
+			dst[k] = s
+			continue
+		}
+		_d, dIsMap := d.(map[string]interface{})
+		_s, sIsMap := s.(map[string]interface{})
+		if dIsMap && sIsMap {
+			dst[k] = mergeMaps(_d, _s)
+		}
+	}
+	return dst
+}
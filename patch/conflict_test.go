@@ -0,0 +1,211 @@
+package patch
+
+import (
+	"encoding/json"
+	"testing"
+
+	"github.com/flashbots/kube-sidecar-injector/config"
+	core_v1 "k8s.io/api/core/v1"
+)
+
+func TestIdentical(t *testing.T) {
+	for _, tc := range []struct {
+		name      string
+		existing  core_v1.Container
+		injected  core_v1.Container
+		identical bool
+	}{
+		{
+			name:      "same",
+			existing:  core_v1.Container{Name: "sidecar", Image: "sidecar:1", Args: []string{"--a"}},
+			injected:  core_v1.Container{Name: "sidecar", Image: "sidecar:1", Args: []string{"--a"}},
+			identical: true,
+		},
+		{
+			name:      "defaults filled in by k8s",
+			existing:  core_v1.Container{Name: "sidecar", Image: "sidecar:1", ImagePullPolicy: core_v1.PullIfNotPresent, TerminationMessagePath: "/dev/termination-log"},
+			injected:  core_v1.Container{Name: "sidecar", Image: "sidecar:1"},
+			identical: true,
+		},
+		{
+			name:      "different value",
+			existing:  core_v1.Container{Name: "sidecar", Image: "sidecar:1"},
+			injected:  core_v1.Container{Name: "sidecar", Image: "sidecar:2"},
+			identical: false,
+		},
+		{
+			name:      "different length of the list",
+			existing:  core_v1.Container{Name: "sidecar", Image: "sidecar:1", Args: []string{"--a"}},
+			injected:  core_v1.Container{Name: "sidecar", Image: "sidecar:1", Args: []string{"--a", "--b"}},
+			identical: false,
+		},
+		{
+			name:      "field missing in the existing element",
+			existing:  core_v1.Container{Name: "sidecar", Image: "sidecar:1"},
+			injected:  core_v1.Container{Name: "sidecar", Image: "sidecar:1", WorkingDir: "/tmp"},
+			identical: false,
+		},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			identical, err := identical(tc.existing, tc.injected)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if identical != tc.identical {
+				t.Errorf("unexpected result: got %v, want %v", identical, tc.identical)
+			}
+		})
+	}
+}
+
+func TestCovers(t *testing.T) {
+	for _, tc := range []struct {
+		name     string
+		existing string
+		injected string
+		covers   bool
+	}{
+		{"equal scalars", `1`, `1`, true},
+		{"different scalars", `1`, `2`, false},
+		{"different types", `{"a": 1}`, `[1]`, false},
+		{"subset of the object", `{"a": 1, "b": 2}`, `{"a": 1}`, true},
+		{"superset of the object", `{"a": 1}`, `{"a": 1, "b": 2}`, false},
+		{"nested objects", `{"a": {"b": 1, "c": 2}}`, `{"a": {"b": 1}}`, true},
+		{"lists of objects", `[{"a": 1, "b": 2}]`, `[{"a": 1}]`, true},
+		{"lists of different length", `[1, 2]`, `[1]`, false},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			var existing, injected interface{}
+			if err := json.Unmarshal([]byte(tc.existing), &existing); err != nil {
+				t.Fatal(err)
+			}
+			if err := json.Unmarshal([]byte(tc.injected), &injected); err != nil {
+				t.Fatal(err)
+			}
+			if covers := covers(existing, injected); covers != tc.covers {
+				t.Errorf("unexpected result: got %v, want %v", covers, tc.covers)
+			}
+		})
+	}
+}
+
+func TestMerge(t *testing.T) {
+	for _, tc := range []struct {
+		name     string
+		existing core_v1.Container
+		injected core_v1.Container
+		expected core_v1.Container
+	}{
+		{
+			name:     "fields of the existing element win",
+			existing: core_v1.Container{Name: "sidecar", Image: "sidecar:1"},
+			injected: core_v1.Container{Name: "sidecar", Image: "sidecar:2"},
+			expected: core_v1.Container{Name: "sidecar", Image: "sidecar:1"},
+		},
+		{
+			name:     "missing fields are filled in",
+			existing: core_v1.Container{Name: "sidecar", Image: "sidecar:1"},
+			injected: core_v1.Container{Name: "sidecar", Image: "sidecar:2", WorkingDir: "/tmp"},
+			expected: core_v1.Container{Name: "sidecar", Image: "sidecar:1", WorkingDir: "/tmp"},
+		},
+		{
+			name: "nested objects are merged",
+			existing: core_v1.Container{Name: "sidecar", SecurityContext: &core_v1.SecurityContext{
+				RunAsUser: ptr(int64(1000)),
+			}},
+			injected: core_v1.Container{Name: "sidecar", SecurityContext: &core_v1.SecurityContext{
+				RunAsUser:  ptr(int64(2000)),
+				RunAsGroup: ptr(int64(2000)),
+			}},
+			expected: core_v1.Container{Name: "sidecar", SecurityContext: &core_v1.SecurityContext{
+				RunAsUser:  ptr(int64(1000)),
+				RunAsGroup: ptr(int64(2000)),
+			}},
+		},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			merged, err := merge(tc.existing, tc.injected)
+			if err != nil {
+				t.Fatal(err)
+			}
+			got, _ := json.Marshal(merged)
+			expected, _ := json.Marshal(tc.expected)
+			if string(got) != string(expected) {
+				t.Errorf("unexpected result:\ngot:  %s\nwant: %s", got, expected)
+			}
+		})
+	}
+}
+
+func TestScalarPolicy(t *testing.T) {
+	for policy, expected := range map[config.ConflictPolicy]config.ConflictPolicy{
+		config.ConflictPolicySkip:     config.ConflictPolicySkip,
+		config.ConflictPolicyOverride: config.ConflictPolicyOverride,
+		config.ConflictPolicyMerge:    config.ConflictPolicySkip,
+		config.ConflictPolicyFail:     config.ConflictPolicyFail,
+	} {
+		if got := scalarPolicy(policy); got != expected {
+			t.Errorf("unexpected policy for %s: got %s, want %s", policy, got, expected)
+		}
+	}
+}
+
+func TestInsertPodVolumesMergeOfDifferentSources(t *testing.T) {
+	pod := &core_v1.Pod{Spec: core_v1.PodSpec{Volumes: []core_v1.Volume{{
+		Name:         "cache",
+		VolumeSource: core_v1.VolumeSource{EmptyDir: &core_v1.EmptyDirVolumeSource{}},
+	}}}}
+	injected := core_v1.Volume{
+		Name: "cache",
+		VolumeSource: core_v1.VolumeSource{ConfigMap: &core_v1.ConfigMapVolumeSource{
+			LocalObjectReference: core_v1.LocalObjectReference{Name: "cm"},
+		}},
+	}
+
+	p, conflicts, err := InsertPodVolumes(pod, []core_v1.Volume{injected}, []config.ConflictPolicy{config.ConflictPolicyMerge})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(p) != 0 {
+		t.Errorf("unexpected patch: %v", p)
+	}
+	if len(conflicts) != 1 || conflicts[0].Policy != config.ConflictPolicySkip {
+		t.Errorf("expected the conflict resolved with skip, got: %+v", conflicts)
+	}
+}
+
+func TestInsertPodVolumesMergeOfSameSources(t *testing.T) {
+	pod := &core_v1.Pod{Spec: core_v1.PodSpec{Volumes: []core_v1.Volume{{
+		Name: "config",
+		VolumeSource: core_v1.VolumeSource{ConfigMap: &core_v1.ConfigMapVolumeSource{
+			LocalObjectReference: core_v1.LocalObjectReference{Name: "cm"},
+		}},
+	}}}}
+	injected := core_v1.Volume{
+		Name: "config",
+		VolumeSource: core_v1.VolumeSource{ConfigMap: &core_v1.ConfigMapVolumeSource{
+			LocalObjectReference: core_v1.LocalObjectReference{Name: "other"},
+			Optional:             ptr(true),
+		}},
+	}
+
+	p, conflicts, err := InsertPodVolumes(pod, []core_v1.Volume{injected}, []config.ConflictPolicy{config.ConflictPolicyMerge})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(conflicts) != 1 || conflicts[0].Policy != config.ConflictPolicyMerge {
+		t.Errorf("expected the conflict resolved with merge, got: %+v", conflicts)
+	}
+	b, err := json.Marshal(p)
+	if err != nil {
+		t.Fatal(err)
+	}
+	expected := `[{"op":"replace","path":"/spec/volumes/0","value":{"name":"config","configMap":{"name":"cm","optional":true}}}]`
+	if string(b) != expected {
+		t.Errorf("unexpected patch:\ngot:  %s\nwant: %s", b, expected)
+	}
+}
+
+func ptr[T any](v T) *T {
+	return &v
+}
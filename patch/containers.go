@@ -1,40 +1,155 @@
 package patch
 
 import (
+	"slices"
+	"strconv"
+
 	json_patch "github.com/evanphx/json-patch"
+	"github.com/flashbots/kube-sidecar-injector/config"
 	"github.com/flashbots/kube-sidecar-injector/operation"
 	core_v1 "k8s.io/api/core/v1"
 )
 
+// InsertPodContainers injects the containers at the requested positions (the
+// position and the policy at index `i` apply to the container at the same
+// index).
+//
+// If the container that the position is relative to does not exist, then the
+// injected container is appended.  If the container with the same name already
+// exists, then it is resolved according to the policy in place (the position is
+// ignored in that case).
 func InsertPodContainers(
 	pod *core_v1.Pod,
 	containers []core_v1.Container,
-) (json_patch.Patch, error) {
+	positions []config.InjectContainerPosition,
+	policies []config.ConflictPolicy,
+) (json_patch.Patch, []Conflict, error) {
+	return insertContainers("/spec/containers", pod.Spec.Containers, containers, positions, policies)
+}
+
+// InsertPodInitContainers is the same as InsertPodContainers, but for
+// init-containers (that are always appended).
+func InsertPodInitContainers(
+	pod *core_v1.Pod,
+	containers []core_v1.Container,
+	policies []config.ConflictPolicy,
+) (json_patch.Patch, []Conflict, error) {
+	return insertContainers("/spec/initContainers", pod.Spec.InitContainers, containers, nil, policies)
+}
+
+func insertContainers(
+	path string,
+	existing []core_v1.Container,
+	containers []core_v1.Container,
+	positions []config.InjectContainerPosition,
+	policies []config.ConflictPolicy,
+) (json_patch.Patch, []Conflict, error) {
 	if len(containers) == 0 {
-		return nil, nil
+		return nil, nil, nil
 	}
 
 	res := make(json_patch.Patch, 0, len(containers))
+	var conflicts []Conflict
 
-	notEmpty := len(pod.Spec.Containers) > 0
-	for _, c := range containers {
+	current := make([]core_v1.Container, 0, len(existing)+len(containers))
+	current = append(current, existing...)
+	names := make([]string, 0, len(current))
+	for _, c := range current {
+		names = append(names, c.Name)
+	}
+
+	for i, c := range containers {
 		var (
 			op  json_patch.Operation
 			err error
 		)
 
-		if notEmpty {
-			op, err = operation.Add("/spec/containers/-", c)
-		} else {
-			notEmpty = true
-			op, err = operation.Add("/spec/containers", []core_v1.Container{c})
+		if idx := slices.Index(names, c.Name); idx >= 0 {
+			same, err := identical(current[idx], c)
+			if err != nil {
+				return nil, nil, err
+			}
+			if same {
+				conflicts = append(conflicts, Conflict{Element: "container", Name: c.Name, Policy: config.ConflictPolicySkip, Identical: true})
+				continue
+			}
+
+			policy := policyAt(policies, i)
+			conflicts = append(conflicts, Conflict{Element: "container", Name: c.Name, Policy: policy})
+
+			switch policy {
+			case config.ConflictPolicyFail:
+				return nil, nil, errConflict("container", c.Name)
+			case config.ConflictPolicyOverride:
+				// use the injected one as is
+			case config.ConflictPolicyMerge:
+				if c, err = merge(current[idx], c); err != nil {
+					return nil, nil, err
+				}
+			default:
+				continue
+			}
+
+			if op, err = operation.Replace(path+"/"+strconv.Itoa(idx), c); err != nil {
+				return nil, nil, err
+			}
+			current[idx] = c
+			res = append(res, op)
+			continue
+		}
+
+		var position config.InjectContainerPosition
+		if i < len(positions) {
+			position = positions[i]
 		}
 
+		idx, err := containerIndex(names, position)
 		if err != nil {
-			return nil, err
+			return nil, nil, err
+		}
+
+		switch {
+		case len(names) == 0:
+			op, err = operation.Add(path, []core_v1.Container{c})
+		case idx == len(names):
+			op, err = operation.Add(path+"/-", c)
+		default:
+			op, err = operation.Add(path+"/"+strconv.Itoa(idx), c)
+		}
+
+		if err != nil {
+			return nil, nil, err
 		}
 		res = append(res, op)
+
+		names = slices.Insert(names, idx, c.Name)
+		current = slices.Insert(current, idx, c)
+	}
+
+	return res, conflicts, nil
+}
+
+func containerIndex(
+	names []string,
+	position config.InjectContainerPosition,
+) (int, error) {
+	kind, container, err := position.Parse()
+	if err != nil {
+		return 0, err
+	}
+
+	switch kind {
+	case config.ContainerPositionFirst:
+		return 0, nil
+	case config.ContainerPositionBefore:
+		if idx := slices.Index(names, container); idx >= 0 {
+			return idx, nil
+		}
+	case config.ContainerPositionAfter:
+		if idx := slices.Index(names, container); idx >= 0 {
+			return idx + 1, nil
+		}
 	}
 
-	return res, nil
+	return len(names), nil
 }
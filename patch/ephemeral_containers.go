@@ -0,0 +1,131 @@
+package patch
+
+import (
+	"reflect"
+	"strconv"
+
+	json_patch "github.com/evanphx/json-patch"
+	"github.com/flashbots/kube-sidecar-injector/operation"
+	core_v1 "k8s.io/api/core/v1"
+)
+
+func InsertEphemeralContainerEnv(
+	idx int,
+	container *core_v1.EphemeralContainer,
+	env []core_v1.EnvVar,
+) (json_patch.Patch, error) {
+	if len(env) == 0 {
+		return nil, nil
+	}
+
+	res := make(json_patch.Patch, 0, len(env))
+
+	notEmpty := len(container.Env) > 0
+	for _, ev := range env {
+		var (
+			op  json_patch.Operation
+			err error
+		)
+
+		if notEmpty {
+			op, err = operation.Add("/spec/ephemeralContainers/"+strconv.Itoa(idx)+"/env/-", ev)
+		} else {
+			notEmpty = true
+			op, err = operation.Add("/spec/ephemeralContainers/"+strconv.Itoa(idx)+"/env", []core_v1.EnvVar{ev})
+		}
+
+		if err != nil {
+			return nil, err
+		}
+		res = append(res, op)
+	}
+
+	return res, nil
+}
+
+func InsertEphemeralContainerVolumeMounts(
+	idx int,
+	container *core_v1.EphemeralContainer,
+	volumeMounts []core_v1.VolumeMount,
+) (json_patch.Patch, error) {
+	if len(volumeMounts) == 0 {
+		return nil, nil
+	}
+
+	res := make(json_patch.Patch, 0, len(volumeMounts))
+
+	notEmpty := len(container.VolumeMounts) > 0
+	for _, vm := range volumeMounts {
+		var (
+			op  json_patch.Operation
+			err error
+		)
+
+		if notEmpty {
+			op, err = operation.Add("/spec/ephemeralContainers/"+strconv.Itoa(idx)+"/volumeMounts/-", vm)
+		} else {
+			notEmpty = true
+			op, err = operation.Add("/spec/ephemeralContainers/"+strconv.Itoa(idx)+"/volumeMounts", []core_v1.VolumeMount{vm})
+		}
+
+		if err != nil {
+			return nil, err
+		}
+		res = append(res, op)
+	}
+
+	return res, nil
+}
+
+// MergeEphemeralContainerSecurityContext fills in the fields of the container's
+// security context that are not explicitly set with the ones from the baseline.
+func MergeEphemeralContainerSecurityContext(
+	idx int,
+	container *core_v1.EphemeralContainer,
+	baseline *core_v1.SecurityContext,
+) (json_patch.Patch, error) {
+	if baseline == nil {
+		return nil, nil
+	}
+
+	merged := &core_v1.SecurityContext{}
+	if container.SecurityContext != nil {
+		merged = container.SecurityContext.DeepCopy()
+	}
+
+	if merged.AllowPrivilegeEscalation == nil {
+		merged.AllowPrivilegeEscalation = baseline.AllowPrivilegeEscalation
+	}
+	if merged.Capabilities == nil {
+		merged.Capabilities = baseline.Capabilities
+	}
+	if merged.Privileged == nil {
+		merged.Privileged = baseline.Privileged
+	}
+	if merged.ReadOnlyRootFilesystem == nil {
+		merged.ReadOnlyRootFilesystem = baseline.ReadOnlyRootFilesystem
+	}
+	if merged.RunAsGroup == nil {
+		merged.RunAsGroup = baseline.RunAsGroup
+	}
+	if merged.RunAsNonRoot == nil {
+		merged.RunAsNonRoot = baseline.RunAsNonRoot
+	}
+	if merged.RunAsUser == nil {
+		merged.RunAsUser = baseline.RunAsUser
+	}
+	if merged.SeccompProfile == nil {
+		merged.SeccompProfile = baseline.SeccompProfile
+	}
+
+	if container.SecurityContext != nil && reflect.DeepEqual(merged, container.SecurityContext) {
+		return nil, nil
+	}
+
+	op, err := operation.Add("/spec/ephemeralContainers/"+strconv.Itoa(idx)+"/securityContext", merged)
+	if err != nil {
+		return nil, err
+	}
+
+	return json_patch.Patch{op}, nil
+}
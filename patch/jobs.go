@@ -0,0 +1,149 @@
+package patch
+
+import (
+	"errors"
+	"fmt"
+	"slices"
+	"strconv"
+	"strings"
+
+	json_patch "github.com/evanphx/json-patch"
+	"github.com/flashbots/kube-sidecar-injector/global"
+	"github.com/flashbots/kube-sidecar-injector/operation"
+	core_v1 "k8s.io/api/core/v1"
+)
+
+const (
+	jobLifecycleVolume    = global.AppName + "-lifecycle"
+	jobLifecycleMountPath = "/var/run/" + global.AppName
+)
+
+var (
+	// ErrCommandNotSet is returned when the container of the job's pod can not
+	// be wrapped because it relies on the entrypoint of its image
+	ErrCommandNotSet = errors.New("container does not set the command")
+)
+
+// WrapJobContainers wraps the commands of the containers of the job's pod, so
+// that the main containers leave a mark in the shared emptyDir when they
+// finish, and the sidecars exit once all of the marks are there.
+//
+// The wrappers rely on `/bin/sh` being available in all of the containers.
+func WrapJobContainers(
+	pod *core_v1.Pod,
+	sidecars []string,
+) (json_patch.Patch, error) {
+	marks := make([]string, 0, len(pod.Spec.Containers))
+	for _, c := range pod.Spec.Containers {
+		if len(c.Command) == 0 {
+			return nil, fmt.Errorf("%w: %s", ErrCommandNotSet, c.Name)
+		}
+		if !slices.Contains(sidecars, c.Name) {
+			marks = append(marks, jobLifecycleMountPath+"/"+c.Name+".done")
+		}
+	}
+
+	res := make(json_patch.Patch, 0, 3*len(pod.Spec.Containers)+1)
+
+	p, _, err := InsertPodVolumes(pod, []core_v1.Volume{{
+		Name: jobLifecycleVolume,
+		VolumeSource: core_v1.VolumeSource{
+			EmptyDir: &core_v1.EmptyDirVolumeSource{},
+		},
+	}}, nil)
+	if err != nil {
+		return nil, err
+	}
+	res = append(res, p...)
+
+	for idx, c := range pod.Spec.Containers {
+		path := "/spec/containers/" + strconv.Itoa(idx)
+
+		// with `OnFailure` the failed containers are restarted in place, so
+		// only the successful exit is the final one
+		script := jobMainScript(
+			jobLifecycleMountPath+"/"+c.Name+".done",
+			pod.Spec.RestartPolicy == core_v1.RestartPolicyOnFailure,
+		)
+		if slices.Contains(sidecars, c.Name) {
+			script = jobSidecarScript(marks)
+		}
+
+		// the original command goes into args, that the script then runs
+		args := make([]string, 0, len(c.Command)+len(c.Args))
+		args = append(args, c.Command...)
+		args = append(args, c.Args...)
+
+		opCommand, err := operation.Replace(path+"/command", []string{"/bin/sh", "-c", script})
+		if err != nil {
+			return nil, err
+		}
+		var opArgs json_patch.Operation
+		if len(c.Args) > 0 {
+			opArgs, err = operation.Replace(path+"/args", args)
+		} else {
+			opArgs, err = operation.Add(path+"/args", args)
+		}
+		if err != nil {
+			return nil, err
+		}
+		res = append(res, opCommand, opArgs)
+
+		p, _, err := InsertContainerVolumeMounts(idx, &c, []core_v1.VolumeMount{{
+			Name:      jobLifecycleVolume,
+			MountPath: jobLifecycleMountPath,
+		}}, nil)
+		if err != nil {
+			return nil, err
+		}
+		res = append(res, p...)
+	}
+
+	return res, nil
+}
+
+func jobMainScript(mark string, onSuccessOnly bool) string {
+	done := `touch '` + mark + `'`
+	if onSuccessOnly {
+		done = `[ $code -eq 0 ] && ` + done
+	}
+
+	// sh runs as pid 1 of the container, and would ignore the sigterm (the
+	// kernel does not apply default handlers to it) => forward it to the child
+	return strings.Join([]string{
+		`rm -f '` + mark + `'`, // the one left by the previous attempt
+		`"$0" "$@" &`,
+		`pid=$!`,
+		`trap 'kill -TERM $pid 2>/dev/null' TERM INT`,
+		`wait $pid`,
+		`code=$?`,
+		`while kill -0 $pid 2>/dev/null; do`,
+		`  wait $pid`,
+		`  code=$?`,
+		`done`,
+		done,
+		`exit $code`,
+	}, "\n")
+}
+
+func jobSidecarScript(marks []string) string {
+	quoted := make([]string, 0, len(marks))
+	for _, mark := range marks {
+		quoted = append(quoted, `'`+mark+`'`)
+	}
+
+	return strings.Join([]string{
+		`"$0" "$@" &`,
+		`pid=$!`,
+		`trap 'kill -TERM $pid 2>/dev/null' TERM INT`,
+		`for mark in ` + strings.Join(quoted, ` `) + `; do`,
+		`  while [ ! -e "$mark" ]; do`,
+		`    kill -0 $pid 2>/dev/null || { wait $pid; exit $?; }`,
+		`    sleep 1`,
+		`  done`,
+		`done`,
+		`kill $pid 2>/dev/null`,
+		`wait $pid`,
+		`exit 0`,
+	}, "\n")
+}
@@ -0,0 +1,104 @@
+package patch
+
+import (
+	"errors"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"testing"
+	"time"
+
+	core_v1 "k8s.io/api/core/v1"
+)
+
+func TestWrapJobContainersWithoutCommand(t *testing.T) {
+	pod := &core_v1.Pod{Spec: core_v1.PodSpec{Containers: []core_v1.Container{
+		{Name: "main", Image: "job"},
+		{Name: "sidecar", Image: "sidecar", Command: []string{"sidecar"}},
+	}}}
+
+	if _, err := WrapJobContainers(pod, []string{"sidecar"}); !errors.Is(err, ErrCommandNotSet) {
+		t.Errorf("expected %v, got: %v", ErrCommandNotSet, err)
+	}
+}
+
+func runScript(script string, command ...string) (int, error) {
+	err := exec.Command("/bin/sh", append([]string{"-c", script}, command...)...).Run()
+	var exitErr *exec.ExitError
+	if errors.As(err, &exitErr) {
+		return exitErr.ExitCode(), nil
+	}
+	return 0, err
+}
+
+func TestJobMainScript(t *testing.T) {
+	if _, err := os.Stat("/bin/sh"); err != nil {
+		t.Skip("no /bin/sh")
+	}
+
+	for _, tc := range []struct {
+		name          string
+		onSuccessOnly bool
+		command       []string
+		code          int
+		marked        bool
+	}{
+		{"success", false, []string{"true"}, 0, true},
+		{"failure", false, []string{"sh", "-c", "exit 3"}, 3, true},
+		{"success on-failure", true, []string{"true"}, 0, true},
+		{"failure on-failure", true, []string{"sh", "-c", "exit 3"}, 3, false},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			mark := filepath.Join(t.TempDir(), "main.done")
+			// the mark of the previous attempt
+			if err := os.WriteFile(mark, nil, 0o644); err != nil {
+				t.Fatal(err)
+			}
+
+			code, err := runScript(jobMainScript(mark, tc.onSuccessOnly), tc.command...)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if code != tc.code {
+				t.Errorf("unexpected exit code: got %d, want %d", code, tc.code)
+			}
+			if _, err := os.Stat(mark); (err == nil) != tc.marked {
+				t.Errorf("unexpected mark: got %v, want %v", err == nil, tc.marked)
+			}
+		})
+	}
+}
+
+func TestJobSidecarScript(t *testing.T) {
+	if _, err := os.Stat("/bin/sh"); err != nil {
+		t.Skip("no /bin/sh")
+	}
+
+	mark := filepath.Join(t.TempDir(), "main.done")
+	go func() {
+		time.Sleep(500 * time.Millisecond)
+		_ = os.WriteFile(mark, nil, 0o644)
+	}()
+
+	type result struct {
+		code int
+		err  error
+	}
+	done := make(chan result, 1)
+	go func() {
+		code, err := runScript(jobSidecarScript([]string{mark}), "sleep", "30")
+		done <- result{code, err}
+	}()
+
+	select {
+	case res := <-done:
+		if res.err != nil {
+			t.Fatal(res.err)
+		}
+		if code := res.code; code != 0 {
+			t.Errorf("unexpected exit code: got %d, want 0", code)
+		}
+	case <-time.After(10 * time.Second):
+		t.Fatal("sidecar did not exit after the mark")
+	}
+}
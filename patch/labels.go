@@ -2,39 +2,16 @@ package patch
 
 import (
 	json_patch "github.com/evanphx/json-patch"
-	"github.com/flashbots/kube-sidecar-injector/operation"
+	"github.com/flashbots/kube-sidecar-injector/config"
 	core_v1 "k8s.io/api/core/v1"
 )
 
+// InsertPodLabels injects the labels resolving the collisions (the labels that
+// the pod already has with a different value) according to the policy.
 func InsertPodLabels(
 	pod *core_v1.Pod,
 	labels map[string]string,
-) (json_patch.Patch, error) {
-	if len(labels) == 0 {
-		return nil, nil
-	}
-
-	if len(pod.Labels) == 0 {
-		op, err := operation.Add("/metadata/labels", labels)
-		if err != nil {
-			return nil, err
-		}
-		return []json_patch.Operation{op}, nil
-	}
-
-	res := make(json_patch.Patch, 0, len(labels))
-
-	for k, v := range labels {
-		if _, exists := pod.Labels[k]; exists {
-			continue
-		}
-
-		op, err := operation.Add("/metadata/labels/"+operation.Escape(k), v)
-		if err != nil {
-			return nil, err
-		}
-		res = append(res, op)
-	}
-
-	return res, nil
+	policy config.ConflictPolicy,
+) (json_patch.Patch, []Conflict, error) {
+	return insertMetadata("/metadata/labels", "label", pod.Labels, labels, policy)
 }
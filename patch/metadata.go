@@ -0,0 +1,70 @@
+package patch
+
+import (
+	"sort"
+
+	json_patch "github.com/evanphx/json-patch"
+	"github.com/flashbots/kube-sidecar-injector/config"
+	"github.com/flashbots/kube-sidecar-injector/operation"
+)
+
+func insertMetadata(
+	path string,
+	element string,
+	existing map[string]string,
+	values map[string]string,
+	policy config.ConflictPolicy,
+) (json_patch.Patch, []Conflict, error) {
+	if len(values) == 0 {
+		return nil, nil, nil
+	}
+
+	if len(existing) == 0 {
+		op, err := operation.Add(path, values)
+		if err != nil {
+			return nil, nil, err
+		}
+		return []json_patch.Operation{op}, nil, nil
+	}
+
+	res := make(json_patch.Patch, 0, len(values))
+	var conflicts []Conflict
+
+	keys := make([]string, 0, len(values))
+	for k := range values {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys) // keep the patch deterministic
+
+	for _, k := range keys {
+		v := values[k]
+		o, exists := existing[k]
+		if !exists {
+			op, err := operation.Add(path+"/"+operation.Escape(k), v)
+			if err != nil {
+				return nil, nil, err
+			}
+			res = append(res, op)
+			continue
+		}
+		if o == v {
+			continue
+		}
+
+		switch policy := scalarPolicy(policy); policy {
+		case config.ConflictPolicyFail:
+			return nil, nil, errConflict(element, k)
+		case config.ConflictPolicyOverride:
+			conflicts = append(conflicts, Conflict{Element: element, Name: k, Policy: policy})
+			op, err := operation.Replace(path+"/"+operation.Escape(k), v)
+			if err != nil {
+				return nil, nil, err
+			}
+			res = append(res, op)
+		default:
+			conflicts = append(conflicts, Conflict{Element: element, Name: k, Policy: policy})
+		}
+	}
+
+	return res, conflicts, nil
+}
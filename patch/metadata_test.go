@@ -0,0 +1,40 @@
+package patch
+
+import (
+	"encoding/json"
+	"testing"
+
+	"github.com/flashbots/kube-sidecar-injector/config"
+	core_v1 "k8s.io/api/core/v1"
+	meta_v1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+)
+
+func TestInsertPodLabelsIsDeterministic(t *testing.T) {
+	pod := &core_v1.Pod{
+		ObjectMeta: meta_v1.ObjectMeta{
+			Labels: map[string]string{"existing": "label", "c": "other"},
+		},
+	}
+	labels := map[string]string{"a": "1", "b": "2", "c": "3", "d": "4", "e": "5", "f": "6"}
+
+	patch := func() string {
+		p, _, err := InsertPodLabels(pod, labels, config.ConflictPolicyOverride)
+		if err != nil {
+			t.Fatal(err)
+		}
+		b, err := json.Marshal(p)
+		if err != nil {
+			t.Fatal(err)
+		}
+		return string(b)
+	}
+
+	// go randomises the iteration order of the maps => repeat enough times
+	// for the unsorted iteration to show up
+	expected := patch()
+	for range 100 {
+		if got := patch(); got != expected {
+			t.Fatalf("patch changed between the runs:\ngot:  %s\nwant: %s", got, expected)
+		}
+	}
+}
@@ -0,0 +1,25 @@
+package patch
+
+import (
+	json_patch "github.com/evanphx/json-patch"
+	"github.com/flashbots/kube-sidecar-injector/operation"
+)
+
+// Prefix moves the patch under the json pointer (for example, to apply the
+// patch generated for the pod to the pod template of the deployment).
+func Prefix(p json_patch.Patch, prefix string) (json_patch.Patch, error) {
+	if len(p) == 0 {
+		return p, nil
+	}
+
+	res := make(json_patch.Patch, 0, len(p))
+	for _, op := range p {
+		_op, err := operation.Prefix(op, prefix)
+		if err != nil {
+			return nil, err
+		}
+		res = append(res, _op)
+	}
+
+	return res, nil
+}
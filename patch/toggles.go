@@ -0,0 +1,54 @@
+package patch
+
+import (
+	json_patch "github.com/evanphx/json-patch"
+	"github.com/flashbots/kube-sidecar-injector/config"
+	"github.com/flashbots/kube-sidecar-injector/operation"
+)
+
+// UpsertPodToggle sets the boolean field of the pod spec resolving the
+// collision (the pod explicitly sets a different value) according to the
+// policy.
+//
+// The `current` is nil when the pod does not set the field explicitly, in which
+// case the `defaultValue` (the one that k8s assumes) is taken into account.
+func UpsertPodToggle(
+	field string,
+	current *bool,
+	defaultValue bool,
+	toggle *config.InjectPodToggle,
+	policy config.ConflictPolicy,
+) (json_patch.Patch, []Conflict, error) {
+	if toggle == nil {
+		return nil, nil, nil
+	}
+
+	value := defaultValue
+	if current != nil {
+		value = *current
+	}
+	if value == toggle.Value {
+		return nil, nil, nil
+	}
+
+	if current == nil {
+		op, err := operation.Add("/spec/"+field, toggle.Value)
+		if err != nil {
+			return nil, nil, err
+		}
+		return json_patch.Patch{op}, nil, nil
+	}
+
+	switch policy := scalarPolicy(policy); policy {
+	case config.ConflictPolicyFail:
+		return nil, nil, errConflict("toggle", field)
+	case config.ConflictPolicyOverride:
+		op, err := operation.Replace("/spec/"+field, toggle.Value)
+		if err != nil {
+			return nil, nil, err
+		}
+		return json_patch.Patch{op}, []Conflict{{Element: "toggle", Name: field, Policy: policy}}, nil
+	default:
+		return nil, []Conflict{{Element: "toggle", Name: field, Policy: policy}}, nil
+	}
+}
@@ -1,40 +1,98 @@
 package patch
 
 import (
+	"strconv"
+
 	json_patch "github.com/evanphx/json-patch"
+	"github.com/flashbots/kube-sidecar-injector/config"
 	"github.com/flashbots/kube-sidecar-injector/operation"
 	core_v1 "k8s.io/api/core/v1"
 )
 
+// InsertTolerations injects the tolerations resolving the collisions according
+// to the policies (the policy at index `i` applies to the toleration at the
+// same index).
+//
+// Tolerations collide when they have the same key and effect (empty effect
+// matches all effects).
 func InsertTolerations(
 	pod *core_v1.Pod,
 	tolerations []core_v1.Toleration,
-) (json_patch.Patch, error) {
+	policies []config.ConflictPolicy,
+) (json_patch.Patch, []Conflict, error) {
 	if len(tolerations) == 0 {
-		return nil, nil
+		return nil, nil, nil
 	}
 
 	res := make(json_patch.Patch, 0, len(tolerations))
+	var conflicts []Conflict
+
+	current := make([]core_v1.Toleration, 0, len(pod.Spec.Tolerations)+len(tolerations))
+	current = append(current, pod.Spec.Tolerations...)
 
-	notEmpty := len(pod.Spec.Tolerations) > 0
-	for _, t := range tolerations {
+	for i, t := range tolerations {
 		var (
 			op  json_patch.Operation
 			err error
 		)
 
-		if notEmpty {
+		if idx := tolerationIndex(current, t); idx >= 0 {
+			same, err := identical(current[idx], t)
+			if err != nil {
+				return nil, nil, err
+			}
+			if same {
+				conflicts = append(conflicts, Conflict{Element: "toleration", Name: t.Key, Policy: config.ConflictPolicySkip, Identical: true})
+				continue
+			}
+
+			policy := policyAt(policies, i)
+			conflicts = append(conflicts, Conflict{Element: "toleration", Name: t.Key, Policy: policy})
+
+			switch policy {
+			case config.ConflictPolicyFail:
+				return nil, nil, errConflict("toleration", t.Key)
+			case config.ConflictPolicyOverride:
+				// use the injected one as is
+			case config.ConflictPolicyMerge:
+				if t, err = merge(current[idx], t); err != nil {
+					return nil, nil, err
+				}
+			default:
+				continue
+			}
+
+			if op, err = operation.Replace("/spec/tolerations/"+strconv.Itoa(idx), t); err != nil {
+				return nil, nil, err
+			}
+			current[idx] = t
+			res = append(res, op)
+			continue
+		}
+
+		if len(current) > 0 {
 			op, err = operation.Add("/spec/tolerations/-", t)
 		} else {
-			notEmpty = true
 			op, err = operation.Add("/spec/tolerations", []core_v1.Toleration{t})
 		}
-
 		if err != nil {
-			return nil, err
+			return nil, nil, err
 		}
+		current = append(current, t)
 		res = append(res, op)
 	}
 
-	return res, nil
+	return res, conflicts, nil
+}
+
+func tolerationIndex(tolerations []core_v1.Toleration, t core_v1.Toleration) int {
+	for idx, o := range tolerations {
+		if o.Key != t.Key {
+			continue
+		}
+		if o.Effect == "" || t.Effect == "" || o.Effect == t.Effect {
+			return idx
+		}
+	}
+	return -1
 }
@@ -4,74 +4,112 @@ import (
 	"strconv"
 
 	json_patch "github.com/evanphx/json-patch"
+	"github.com/flashbots/kube-sidecar-injector/config"
 	"github.com/flashbots/kube-sidecar-injector/operation"
 	core_v1 "k8s.io/api/core/v1"
 )
 
+// InsertContainerVolumeMounts injects the volume mounts into the container
+// resolving the collisions by mount path according to the policies (the policy
+// at index `i` applies to the volume mount at the same index).
 func InsertContainerVolumeMounts(
 	idx int,
 	container *core_v1.Container,
 	volumeMounts []core_v1.VolumeMount,
-) (json_patch.Patch, error) {
-	if len(volumeMounts) == 0 {
-		return nil, nil
-	}
-
-	res := make(json_patch.Patch, 0, len(volumeMounts))
-
-	notEmpty := len(container.VolumeMounts) > 0
-	for _, vm := range volumeMounts {
-		var (
-			op  json_patch.Operation
-			err error
-		)
-
-		if notEmpty {
-			op, err = operation.Add("/spec/containers/"+strconv.Itoa(idx)+"/volumeMounts/-", vm)
-		} else {
-			notEmpty = true
-			op, err = operation.Add("/spec/containers/"+strconv.Itoa(idx)+"/volumeMounts", []core_v1.VolumeMount{vm})
-		}
-
-		if err != nil {
-			return nil, err
-		}
-		res = append(res, op)
-	}
-
-	return res, nil
+	policies []config.ConflictPolicy,
+) (json_patch.Patch, []Conflict, error) {
+	return insertVolumeMounts(
+		"/spec/containers/"+strconv.Itoa(idx)+"/volumeMounts",
+		container, volumeMounts, policies,
+	)
 }
 
+// InsertInitContainerVolumeMounts is the same as InsertContainerVolumeMounts,
+// but for init-containers.
 func InsertInitContainerVolumeMounts(
 	idx int,
 	container *core_v1.Container,
 	volumeMounts []core_v1.VolumeMount,
-) (json_patch.Patch, error) {
+	policies []config.ConflictPolicy,
+) (json_patch.Patch, []Conflict, error) {
+	return insertVolumeMounts(
+		"/spec/initContainers/"+strconv.Itoa(idx)+"/volumeMounts",
+		container, volumeMounts, policies,
+	)
+}
+
+func insertVolumeMounts(
+	path string,
+	container *core_v1.Container,
+	volumeMounts []core_v1.VolumeMount,
+	policies []config.ConflictPolicy,
+) (json_patch.Patch, []Conflict, error) {
 	if len(volumeMounts) == 0 {
-		return nil, nil
+		return nil, nil, nil
 	}
 
 	res := make(json_patch.Patch, 0, len(volumeMounts))
+	var conflicts []Conflict
 
-	notEmpty := len(container.VolumeMounts) > 0
-	for _, vm := range volumeMounts {
+	current := make([]core_v1.VolumeMount, 0, len(container.VolumeMounts)+len(volumeMounts))
+	current = append(current, container.VolumeMounts...)
+	existing := make(map[string]int, len(current))
+	for idx, vm := range current {
+		existing[vm.MountPath] = idx
+	}
+
+	for i, vm := range volumeMounts {
 		var (
 			op  json_patch.Operation
 			err error
 		)
 
-		if notEmpty {
-			op, err = operation.Add("/spec/initContainers/"+strconv.Itoa(idx)+"/volumeMounts/-", vm)
-		} else {
-			notEmpty = true
-			op, err = operation.Add("/spec/initContainers/"+strconv.Itoa(idx)+"/volumeMounts", []core_v1.VolumeMount{vm})
+		if idx, collision := existing[vm.MountPath]; collision {
+			same, err := identical(current[idx], vm)
+			if err != nil {
+				return nil, nil, err
+			}
+			if same {
+				conflicts = append(conflicts, Conflict{Element: "volumeMount", Name: vm.MountPath, Container: container.Name, Policy: config.ConflictPolicySkip, Identical: true})
+				continue
+			}
+
+			policy := policyAt(policies, i)
+			conflicts = append(conflicts, Conflict{Element: "volumeMount", Name: vm.MountPath, Container: container.Name, Policy: policy})
+
+			switch policy {
+			case config.ConflictPolicyFail:
+				return nil, nil, errConflict("volumeMount", container.Name+":"+vm.MountPath)
+			case config.ConflictPolicyOverride:
+				// use the injected one as is
+			case config.ConflictPolicyMerge:
+				if vm, err = merge(current[idx], vm); err != nil {
+					return nil, nil, err
+				}
+			default:
+				continue
+			}
+
+			if op, err = operation.Replace(path+"/"+strconv.Itoa(idx), vm); err != nil {
+				return nil, nil, err
+			}
+			current[idx] = vm
+			res = append(res, op)
+			continue
 		}
 
+		if len(current) > 0 {
+			op, err = operation.Add(path+"/-", vm)
+		} else {
+			op, err = operation.Add(path, []core_v1.VolumeMount{vm})
+		}
 		if err != nil {
-			return nil, err
+			return nil, nil, err
 		}
+		existing[vm.MountPath] = len(current)
+		current = append(current, vm)
 		res = append(res, op)
 	}
 
-	return res, nil
+	return res, conflicts, nil
 }
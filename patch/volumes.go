@@ -1,40 +1,127 @@
 package patch
 
 import (
+	"strconv"
+
 	json_patch "github.com/evanphx/json-patch"
+	"github.com/flashbots/kube-sidecar-injector/config"
 	"github.com/flashbots/kube-sidecar-injector/operation"
 	core_v1 "k8s.io/api/core/v1"
 )
 
+// InsertPodVolumes injects the volumes resolving the collisions by name
+// according to the policies (the policy at index `i` applies to the volume at
+// the same index).
 func InsertPodVolumes(
 	pod *core_v1.Pod,
 	volumes []core_v1.Volume,
-) (json_patch.Patch, error) {
+	policies []config.ConflictPolicy,
+) (json_patch.Patch, []Conflict, error) {
 	if len(volumes) == 0 {
-		return nil, nil
+		return nil, nil, nil
 	}
 
 	res := make(json_patch.Patch, 0, len(volumes))
+	var conflicts []Conflict
+
+	current := make([]core_v1.Volume, 0, len(pod.Spec.Volumes)+len(volumes))
+	current = append(current, pod.Spec.Volumes...)
+	existing := make(map[string]int, len(current))
+	for idx, v := range current {
+		existing[v.Name] = idx
+	}
 
-	notEmpty := len(pod.Spec.Volumes) > 0
-	for _, v := range volumes {
+	for i, v := range volumes {
 		var (
 			op  json_patch.Operation
 			err error
 		)
 
-		if notEmpty {
+		if idx, collision := existing[v.Name]; collision {
+			same, err := identical(current[idx], v)
+			if err != nil {
+				return nil, nil, err
+			}
+			if same {
+				conflicts = append(conflicts, Conflict{Element: "volume", Name: v.Name, Policy: config.ConflictPolicySkip, Identical: true})
+				continue
+			}
+
+			policy := policyAt(policies, i)
+			if policy == config.ConflictPolicyMerge {
+				sameSource, err := sameVolumeSource(current[idx], v)
+				if err != nil {
+					return nil, nil, err
+				}
+				if !sameSource {
+					// the volume can have only one source => existing one wins
+					policy = config.ConflictPolicySkip
+				}
+			}
+			conflicts = append(conflicts, Conflict{Element: "volume", Name: v.Name, Policy: policy})
+
+			switch policy {
+			case config.ConflictPolicyFail:
+				return nil, nil, errConflict("volume", v.Name)
+			case config.ConflictPolicyOverride:
+				// use the injected one as is
+			case config.ConflictPolicyMerge:
+				if v, err = merge(current[idx], v); err != nil {
+					return nil, nil, err
+				}
+			default:
+				continue
+			}
+
+			if op, err = operation.Replace("/spec/volumes/"+strconv.Itoa(idx), v); err != nil {
+				return nil, nil, err
+			}
+			current[idx] = v
+			res = append(res, op)
+			continue
+		}
+
+		if len(current) > 0 {
 			op, err = operation.Add("/spec/volumes/-", v)
 		} else {
-			notEmpty = true
 			op, err = operation.Add("/spec/volumes", []core_v1.Volume{v})
 		}
-
 		if err != nil {
-			return nil, err
+			return nil, nil, err
 		}
+		existing[v.Name] = len(current)
+		current = append(current, v)
 		res = append(res, op)
 	}
 
-	return res, nil
+	return res, conflicts, nil
+}
+
+func policyAt(policies []config.ConflictPolicy, idx int) config.ConflictPolicy {
+	if idx < len(policies) && policies[idx] != "" {
+		return policies[idx]
+	}
+	return config.ConflictPolicySkip
+}
+
+// sameVolumeSource returns true if both volumes have the source of the same
+// type (for example, both are config-maps), so that they can be merged.
+func sameVolumeSource(existing, injected core_v1.Volume) (bool, error) {
+	_existing, err := toMap(existing.VolumeSource)
+	if err != nil {
+		return false, err
+	}
+	_injected, err := toMap(injected.VolumeSource)
+	if err != nil {
+		return false, err
+	}
+	if len(_existing) != len(_injected) {
+		return false, nil
+	}
+	for source := range _injected {
+		if _, exists := _existing[source]; !exists {
+			return false, nil
+		}
+	}
+	return true, nil
 }
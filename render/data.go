@@ -0,0 +1,77 @@
+package render
+
+import (
+	core_v1 "k8s.io/api/core/v1"
+)
+
+// Pod is the data that templates are rendered with
+type Pod struct {
+	Name               string
+	GenerateName       string
+	Namespace          string
+	ServiceAccountName string
+
+	Labels      map[string]string
+	Annotations map[string]string
+
+	Containers []Container
+
+	// Params are the values of inject rule parameters (with pod's overrides)
+	Params map[string]string
+}
+
+type Container struct {
+	Name  string
+	Image string
+	Ports []ContainerPort
+}
+
+type ContainerPort struct {
+	Name          string
+	ContainerPort int32
+	Protocol      string
+}
+
+func newPod(pod *core_v1.Pod, params map[string]string) *Pod {
+	res := &Pod{
+		Name:               pod.Name,
+		GenerateName:       pod.GenerateName,
+		Namespace:          pod.Namespace,
+		ServiceAccountName: pod.Spec.ServiceAccountName,
+
+		Labels:      pod.Labels,
+		Annotations: pod.Annotations,
+
+		Containers: make([]Container, 0, len(pod.Spec.Containers)),
+
+		Params: params,
+	}
+
+	if res.Labels == nil {
+		res.Labels = map[string]string{}
+	}
+	if res.Annotations == nil {
+		res.Annotations = map[string]string{}
+	}
+	if res.Params == nil {
+		res.Params = map[string]string{}
+	}
+
+	for _, c := range pod.Spec.Containers {
+		ports := make([]ContainerPort, 0, len(c.Ports))
+		for _, p := range c.Ports {
+			ports = append(ports, ContainerPort{
+				Name:          p.Name,
+				ContainerPort: p.ContainerPort,
+				Protocol:      string(p.Protocol),
+			})
+		}
+		res.Containers = append(res.Containers, Container{
+			Name:  c.Name,
+			Image: c.Image,
+			Ports: ports,
+		})
+	}
+
+	return res
+}
@@ -0,0 +1,152 @@
+package render
+
+import (
+	"github.com/flashbots/kube-sidecar-injector/config"
+	core_v1 "k8s.io/api/core/v1"
+)
+
+// Inject returns the copy of the inject-configuration with all templated
+// values rendered for the given pod and parameter values.
+//
+// The templated values are:
+//
+//   - annotation and label values
+//   - commands, args, and env values of the containers (including native ones)
+//   - resource limits and requests of the containers
+//   - env values of the ephemeral containers
+func Inject(
+	inject *config.Inject,
+	pod *core_v1.Pod,
+	params map[string]string,
+) (*config.Inject, error) {
+	data := newPod(pod, params)
+
+	var err error
+	res := transform(inject, func(text string) string {
+		if err != nil {
+			return text
+		}
+		var rendered string
+		rendered, err = String(text, data)
+		return rendered
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	return res, nil
+}
+
+// Defaults returns the copy of the inject-configuration with all templated
+// values rendered for an empty pod and default parameter values.  The values
+// that can not be rendered without the actual pod are left as they are.
+func Defaults(inject *config.Inject) *config.Inject {
+	params := make(map[string]string, len(inject.Parameters))
+	for _, p := range inject.Parameters {
+		params[p.Name] = p.Default
+	}
+	data := newPod(&core_v1.Pod{}, params)
+
+	return transform(inject, func(text string) string {
+		rendered, err := String(text, data)
+		if err != nil {
+			return text
+		}
+		return rendered
+	})
+}
+
+// CheckInject makes sure that all templated values of the inject-configuration
+// are valid templates.
+func CheckInject(inject *config.Inject) error {
+	var err error
+	transform(inject, func(text string) string {
+		if err == nil {
+			err = Check(text)
+		}
+		return text
+	})
+	return err
+}
+
+// transform returns the copy of the inject-configuration with all templated
+// values replaced by the result of the function.
+func transform(inject *config.Inject, fn func(string) string) *config.Inject {
+	res := *inject
+
+	res.Annotations = transformMap(inject.Annotations, fn)
+	res.Labels = transformMap(inject.Labels, fn)
+
+	if len(inject.Containers) > 0 {
+		res.Containers = make([]config.InjectContainer, 0, len(inject.Containers))
+		for _, c := range inject.Containers {
+			c.Command = transformSlice(c.Command, fn)
+			c.Args = transformSlice(c.Args, fn)
+			c.Env = transformEnv(c.Env, fn)
+			if c.Resources != nil {
+				resources := *c.Resources
+				resources.Limits = transformMap(resources.Limits, fn)
+				resources.Requests = transformMap(resources.Requests, fn)
+				c.Resources = &resources
+			}
+			res.Containers = append(res.Containers, c)
+		}
+	}
+
+	if inject.Native != nil && len(inject.Native.Containers) > 0 {
+		native := *inject.Native
+		native.Containers = make([]core_v1.Container, 0, len(inject.Native.Containers))
+		for _, _c := range inject.Native.Containers {
+			c := _c.DeepCopy()
+			c.Command = transformSlice(c.Command, fn)
+			c.Args = transformSlice(c.Args, fn)
+			for idx := range c.Env {
+				c.Env[idx].Value = fn(c.Env[idx].Value)
+			}
+			native.Containers = append(native.Containers, *c)
+		}
+		res.Native = &native
+	}
+
+	if inject.EphemeralContainers != nil && len(inject.EphemeralContainers.Env) > 0 {
+		ephemeralContainers := *inject.EphemeralContainers
+		ephemeralContainers.Env = transformEnv(inject.EphemeralContainers.Env, fn)
+		res.EphemeralContainers = &ephemeralContainers
+	}
+
+	return &res
+}
+
+func transformEnv(env []config.InjectEnvVar, fn func(string) string) []config.InjectEnvVar {
+	if env == nil {
+		return nil
+	}
+	res := make([]config.InjectEnvVar, 0, len(env))
+	for _, ev := range env {
+		ev.Value = fn(ev.Value)
+		res = append(res, ev)
+	}
+	return res
+}
+
+func transformMap(m map[string]string, fn func(string) string) map[string]string {
+	if m == nil {
+		return nil
+	}
+	res := make(map[string]string, len(m))
+	for k, v := range m {
+		res[k] = fn(v)
+	}
+	return res
+}
+
+func transformSlice(s []string, fn func(string) string) []string {
+	if s == nil {
+		return nil
+	}
+	res := make([]string, 0, len(s))
+	for _, v := range s {
+		res = append(res, fn(v))
+	}
+	return res
+}
@@ -0,0 +1,119 @@
+package render
+
+import (
+	"errors"
+	"fmt"
+	"strings"
+	"sync"
+	"text/template"
+)
+
+var (
+	errTemplateFailedToParse  = errors.New("failed to parse template")
+	errTemplateFailedToRender = errors.New("failed to render template")
+)
+
+// funcs is the complete set of functions (on top of text/template builtins)
+// available to the templates.  None of them has access to anything beyond
+// their arguments.
+var funcs = template.FuncMap{
+	"contains":   strings.Contains,
+	"default":    _default,
+	"hasPrefix":  strings.HasPrefix,
+	"hasSuffix":  strings.HasSuffix,
+	"join":       join,
+	"lower":      strings.ToLower,
+	"quote":      quote,
+	"replace":    replace,
+	"split":      split,
+	"trim":       strings.TrimSpace,
+	"trimPrefix": trimPrefix,
+	"trimSuffix": trimSuffix,
+	"upper":      strings.ToUpper,
+}
+
+var parsed sync.Map // text => *template.Template
+
+func isTemplate(text string) bool {
+	return strings.Contains(text, "{{")
+}
+
+func parse(text string) (*template.Template, error) {
+	if tpl, found := parsed.Load(text); found {
+		return tpl.(*template.Template), nil
+	}
+
+	tpl, err := template.New("").
+		Funcs(funcs).
+		Option("missingkey=error").
+		Parse(text)
+	if err != nil {
+		return nil, fmt.Errorf("%w: %s: %w",
+			errTemplateFailedToParse, text, err,
+		)
+	}
+
+	parsed.Store(text, tpl)
+	return tpl, nil
+}
+
+// Check makes sure that the text is a valid template
+func Check(text string) error {
+	if !isTemplate(text) {
+		return nil
+	}
+	_, err := parse(text)
+	return err
+}
+
+// String renders the text with the provided data
+func String(text string, data interface{}) (string, error) {
+	if !isTemplate(text) {
+		return text, nil
+	}
+
+	tpl, err := parse(text)
+	if err != nil {
+		return "", err
+	}
+
+	var res strings.Builder
+	if err := tpl.Execute(&res, data); err != nil {
+		return "", fmt.Errorf("%w: %s: %w",
+			errTemplateFailedToRender, text, err,
+		)
+	}
+
+	return res.String(), nil
+}
+
+func _default(fallback string, value interface{}) string {
+	if s := fmt.Sprint(value); value != nil && s != "" {
+		return s
+	}
+	return fallback
+}
+
+func join(sep string, elems []string) string {
+	return strings.Join(elems, sep)
+}
+
+func quote(s string) string {
+	return fmt.Sprintf("%q", s)
+}
+
+func replace(old, new, s string) string {
+	return strings.ReplaceAll(s, old, new)
+}
+
+func split(sep, s string) []string {
+	return strings.Split(s, sep)
+}
+
+func trimPrefix(prefix, s string) string {
+	return strings.TrimPrefix(s, prefix)
+}
+
+func trimSuffix(suffix, s string) string {
+	return strings.TrimSuffix(s, suffix)
+}
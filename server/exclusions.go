@@ -0,0 +1,55 @@
+package server
+
+import (
+	meta_v1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+)
+
+const (
+	labelAppName       = "app.kubernetes.io/name"
+	labelNamespaceName = "kubernetes.io/metadata.name"
+)
+
+// withDefaultExclusions merges the exclusions of the injector's own namespace,
+// kube-system, and the injector's own pods into the selectors of the webhook
+// (so that the broken injector could not block its own rescheduling).
+func (s *Server) withDefaultExclusions(
+	namespaceSelector, objectSelector *meta_v1.LabelSelector,
+) (
+	*meta_v1.LabelSelector, *meta_v1.LabelSelector,
+) {
+	if s.cfg.K8S.DisableDefaultExclusions {
+		return namespaceSelector, objectSelector
+	}
+
+	namespaces := []string{s.cfg.K8S.Namespace}
+	if s.cfg.K8S.Namespace != "kube-system" {
+		namespaces = append(namespaces, "kube-system")
+	}
+
+	namespaceSelector = withRequirement(namespaceSelector, meta_v1.LabelSelectorRequirement{
+		Key:      labelNamespaceName,
+		Operator: meta_v1.LabelSelectorOpNotIn,
+		Values:   namespaces,
+	})
+
+	objectSelector = withRequirement(objectSelector, meta_v1.LabelSelectorRequirement{
+		Key:      labelAppName,
+		Operator: meta_v1.LabelSelectorOpNotIn,
+		Values:   []string{s.cfg.K8S.ServiceName},
+	})
+
+	return namespaceSelector, objectSelector
+}
+
+func withRequirement(
+	selector *meta_v1.LabelSelector,
+	requirement meta_v1.LabelSelectorRequirement,
+) *meta_v1.LabelSelector {
+	if selector == nil {
+		selector = &meta_v1.LabelSelector{}
+	} else {
+		selector = selector.DeepCopy()
+	}
+	selector.MatchExpressions = append(selector.MatchExpressions, requirement)
+	return selector
+}
@@ -30,6 +30,11 @@ var (
 )
 
 func (s *Server) handleHealthcheck(w http.ResponseWriter, r *http.Request) {
+	if !s.ready.Load() {
+		// the mutations rely on the caches of the informers
+		http.Error(w, "Informers are not synced yet", http.StatusServiceUnavailable)
+		return
+	}
 	w.WriteHeader(http.StatusOK)
 }
 
@@ -42,6 +47,13 @@ func (s *Server) handleWebhook(w http.ResponseWriter, r *http.Request) {
 		}
 	}()
 
+	if !s.ready.Load() {
+		const msg = "Informers are not synced yet"
+		l.Warn(msg)
+		http.Error(w, msg, http.StatusServiceUnavailable)
+		return
+	}
+
 	if contentType := r.Header.Get("Content-Type"); contentType != "application/json" {
 		const msg = "Invalid content type"
 		l.Error(msg, zap.String("contentType", contentType))
@@ -0,0 +1,34 @@
+package server
+
+import (
+	"github.com/flashbots/kube-sidecar-injector/config"
+	core_v1 "k8s.io/api/core/v1"
+	k8s_version "k8s.io/apimachinery/pkg/util/version"
+)
+
+var (
+	k8sVersionNativeSidecars = k8s_version.MustParseGeneric("v1.29.0")
+)
+
+// ownedByJob returns true if the pod is owned by the job (or, if it's the pod
+// template of the workload, by the cron-job).
+func ownedByJob(pod *core_v1.Pod) bool {
+	for _, owner := range pod.OwnerReferences {
+		if owner.Kind == "Job" || owner.Kind == "CronJob" {
+			return true
+		}
+	}
+	return false
+}
+
+// jobSidecars resolves the mode in which the sidecars are injected into the
+// pods of the jobs.
+func (s *Server) jobSidecars(jobs *config.InjectJobs) string {
+	if jobs.Sidecars != "" && jobs.Sidecars != config.JobSidecarsAuto {
+		return jobs.Sidecars
+	}
+	if s.k8sVersion != nil && s.k8sVersion.AtLeast(k8sVersionNativeSidecars) {
+		return config.JobSidecarsNative
+	}
+	return config.JobSidecarsWrapper
+}
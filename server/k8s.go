@@ -5,25 +5,36 @@ import (
 	"encoding/json"
 	"errors"
 	"fmt"
+	"net/http"
 	"strconv"
 	"time"
 
 	json_patch "github.com/evanphx/json-patch"
+	"github.com/flashbots/kube-sidecar-injector/config"
+	"github.com/flashbots/kube-sidecar-injector/fargate"
 	"github.com/flashbots/kube-sidecar-injector/global"
 	"github.com/flashbots/kube-sidecar-injector/logutils"
 	"github.com/flashbots/kube-sidecar-injector/patch"
+	"github.com/flashbots/kube-sidecar-injector/render"
 	"go.uber.org/zap"
 	admission_v1 "k8s.io/api/admission/v1"
 	admission_registration_v1 "k8s.io/api/admissionregistration/v1"
+	authentication_v1 "k8s.io/api/authentication/v1"
 	core_v1 "k8s.io/api/core/v1"
 	k8s_errors "k8s.io/apimachinery/pkg/api/errors"
 	meta_v1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	k8s_version "k8s.io/apimachinery/pkg/util/version"
 )
 
 var (
+	errAtomicInjectSkipped                        = errors.New("atomic inject-configuration can not be applied in full")
 	errFailedToUpsertMutatingWebhookConfiguration = errors.New("failed to upsert mutating webhook configuration")
 )
 
+var (
+	k8sVersionMatchConditions = k8s_version.MustParseGeneric("v1.28.0")
+)
+
 func (s *Server) upsertMutatingWebhookConfiguration(ctx context.Context) error {
 	l := logutils.LoggerFromContext(ctx)
 
@@ -46,8 +57,14 @@ func (s *Server) upsertMutatingWebhookConfiguration(ctx context.Context) error {
 	sideEffectClass_None := admission_registration_v1.SideEffectClassNone
 	reinvocationPolicy_IfNeeded := admission_registration_v1.IfNeededReinvocationPolicy
 
+	matchConditions := s.matchConditionsSupported(ctx)
+
 	webhooks := make([]admission_registration_v1.MutatingWebhook, 0, len(s.cfg.Inject))
 	for _, i := range s.cfg.Inject {
+		if i.OnDemand {
+			continue // see below
+		}
+
 		var (
 			objectSelector, namespaceSelector *meta_v1.LabelSelector
 			err                               error
@@ -65,6 +82,39 @@ func (s *Server) upsertMutatingWebhookConfiguration(ctx context.Context) error {
 			}
 		}
 
+		namespaceSelector, objectSelector = s.withDefaultExclusions(namespaceSelector, objectSelector)
+
+		rules := []admission_registration_v1.RuleWithOperations{{
+			Operations: i.Operations.OperationTypes(),
+
+			Rule: admission_registration_v1.Rule{
+				APIGroups:   []string{""},
+				APIVersions: []string{"v1", "v1beta1"},
+				Resources:   []string{"pods"},
+			},
+		}}
+
+		if i.EphemeralContainers != nil {
+			rules = append(rules, admission_registration_v1.RuleWithOperations{
+				Operations: []admission_registration_v1.OperationType{
+					admission_registration_v1.Update,
+				},
+
+				Rule: admission_registration_v1.Rule{
+					APIGroups:   []string{""},
+					APIVersions: []string{"v1"},
+					Resources:   []string{"pods/ephemeralcontainers"},
+				},
+			})
+		}
+
+		var conditions []admission_registration_v1.MatchCondition
+		if matchConditions {
+			for _, mc := range i.MatchConditions {
+				conditions = append(conditions, mc.MatchCondition())
+			}
+		}
+
 		fingerprint := i.Fingerprint()
 		pathWebhook := s.cfg.Server.PathWebhook + "/" + fingerprint
 
@@ -76,6 +126,7 @@ func (s *Server) upsertMutatingWebhookConfiguration(ctx context.Context) error {
 			AdmissionReviewVersions: []string{"v1", "v1beta1"},
 			ObjectSelector:          objectSelector,
 			NamespaceSelector:       namespaceSelector,
+			MatchConditions:         conditions,
 
 			FailurePolicy:      &failurePolicy_Ignore,
 			ReinvocationPolicy: &reinvocationPolicy_IfNeeded,
@@ -92,11 +143,124 @@ func (s *Server) upsertMutatingWebhookConfiguration(ctx context.Context) error {
 				},
 			},
 
-			Rules: []admission_registration_v1.RuleWithOperations{{
-				Operations: []admission_registration_v1.OperationType{
-					admission_registration_v1.Create,
-					admission_registration_v1.Update,
+			Rules: rules,
+		})
+
+		if i.Workloads {
+			// pod templates are matched against the label selector at the
+			// admission (object selector would match workload's own labels)
+			_, workloadsObjectSelector := s.withDefaultExclusions(nil, nil)
+
+			workloadsRules := []admission_registration_v1.RuleWithOperations{
+				{
+					Operations: i.Operations.OperationTypes(),
+
+					Rule: admission_registration_v1.Rule{
+						APIGroups:   []string{"apps"},
+						APIVersions: []string{"v1"},
+						Resources:   []string{"daemonsets", "deployments", "statefulsets"},
+					},
+				},
+				{
+					Operations: i.Operations.OperationTypes(),
+
+					Rule: admission_registration_v1.Rule{
+						APIGroups:   []string{"batch"},
+						APIVersions: []string{"v1"},
+						Resources:   []string{"cronjobs"},
+					},
+				},
+			}
+
+			if i.Operations.Allows(string(admission_registration_v1.Create)) {
+				// the template of the job is immutable => only on create
+				workloadsRules = append(workloadsRules, admission_registration_v1.RuleWithOperations{
+					Operations: []admission_registration_v1.OperationType{
+						admission_registration_v1.Create,
+					},
+
+					Rule: admission_registration_v1.Rule{
+						APIGroups:   []string{"batch"},
+						APIVersions: []string{"v1"},
+						Resources:   []string{"jobs"},
+					},
+				})
+			}
+
+			webhooks = append(webhooks, admission_registration_v1.MutatingWebhook{
+				Name: fmt.Sprintf("%s-workloads.%s.%s",
+					fingerprint, s.cfg.K8S.MutatingWebhookConfigurationName, global.OrgDomain,
+				),
+
+				AdmissionReviewVersions: []string{"v1", "v1beta1"},
+				ObjectSelector:          workloadsObjectSelector,
+				NamespaceSelector:       namespaceSelector,
+
+				FailurePolicy:      &failurePolicy_Ignore,
+				ReinvocationPolicy: &reinvocationPolicy_IfNeeded,
+				SideEffects:        &sideEffectClass_None,
+
+				ClientConfig: admission_registration_v1.WebhookClientConfig{
+					CABundle: s.tls.CA,
+
+					Service: &admission_registration_v1.ServiceReference{
+						Name:      s.cfg.K8S.ServiceName,
+						Namespace: s.cfg.K8S.Namespace,
+						Path:      &pathWebhook,
+						Port:      &s.cfg.K8S.ServicePortNumber,
+					},
+				},
+
+				Rules: workloadsRules,
+			})
+		}
+	}
+
+	if len(s.onDemand) > 0 {
+		// the pods request on-demand rules with the annotation, and these
+		// can not be selected by the webhook => it has to match everything
+		pathWebhook := s.cfg.Server.PathWebhook + "/" + onDemandFingerprint
+		namespaceSelector, objectSelector := s.withDefaultExclusions(nil, nil)
+
+		operations := make([]admission_registration_v1.OperationType, 0, 2)
+		for _, op := range []admission_registration_v1.OperationType{
+			admission_registration_v1.Create,
+			admission_registration_v1.Update,
+		} {
+			for _, i := range s.cfg.Inject {
+				if i.OnDemand && i.Operations.Allows(string(op)) {
+					operations = append(operations, op)
+					break
+				}
+			}
+		}
+
+		webhooks = append(webhooks, admission_registration_v1.MutatingWebhook{
+			Name: fmt.Sprintf("%s.%s.%s",
+				onDemandFingerprint, s.cfg.K8S.MutatingWebhookConfigurationName, global.OrgDomain,
+			),
+
+			AdmissionReviewVersions: []string{"v1", "v1beta1"},
+			ObjectSelector:          objectSelector,
+			NamespaceSelector:       namespaceSelector,
+
+			FailurePolicy:      &failurePolicy_Ignore,
+			ReinvocationPolicy: &reinvocationPolicy_IfNeeded,
+			SideEffects:        &sideEffectClass_None,
+
+			ClientConfig: admission_registration_v1.WebhookClientConfig{
+				CABundle: s.tls.CA,
+
+				Service: &admission_registration_v1.ServiceReference{
+					Name:      s.cfg.K8S.ServiceName,
+					Namespace: s.cfg.K8S.Namespace,
+					Path:      &pathWebhook,
+					Port:      &s.cfg.K8S.ServicePortNumber,
 				},
+			},
+
+			Rules: []admission_registration_v1.RuleWithOperations{{
+				Operations: operations,
 
 				Rule: admission_registration_v1.Rule{
 					APIGroups:   []string{""},
@@ -132,6 +296,33 @@ func (s *Server) upsertMutatingWebhookConfiguration(ctx context.Context) error {
 	return nil
 }
 
+// matchConditionsSupported checks whether match conditions can be set on the
+// webhooks (if the version of k8s is unknown, they are assumed to be).
+func (s *Server) matchConditionsSupported(ctx context.Context) bool {
+	l := logutils.LoggerFromContext(ctx)
+
+	var reason string
+	switch {
+	case s.cfg.K8S.DisableMatchConditions:
+		reason = "match conditions are disabled"
+	case s.k8sVersion != nil && !s.k8sVersion.AtLeast(k8sVersionMatchConditions):
+		reason = "k8s " + s.k8sVersion.String() + " does not support match conditions"
+	default:
+		return true
+	}
+
+	// the rules are then applied to more pods than they are meant to
+	for _, i := range s.cfg.Inject {
+		if len(i.MatchConditions) > 0 {
+			l.Warn("Leaving match conditions of inject-configuration out => it will apply to all pods that match its selectors...",
+				zap.String("injectName", i.Name),
+				zap.String("reason", reason),
+			)
+		}
+	}
+	return false
+}
+
 func (s *Server) mutate(
 	ctx context.Context,
 	req *admission_v1.AdmissionRequest,
@@ -144,21 +335,52 @@ func (s *Server) mutate(
 		UID:     req.UID,
 	}
 
-	if req.Kind.Kind != "Pod" || req.Kind.Group != "" {
-		l.Warn("Received admission request for a non-pod object => skipping...",
-			zap.String("group", req.Kind.Group),
-			zap.String("kind", req.Kind.Kind),
-		)
-		return res
-	}
-
-	pod := &core_v1.Pod{}
-	if err := json.Unmarshal(req.Object.Raw, pod); err != nil {
-		l.Error("Failed to decode raw object for pod",
-			zap.Error(err),
-		)
-		res.Result = &meta_v1.Status{Message: err.Error()}
-		return res
+	var (
+		pod      *core_v1.Pod
+		template string // json pointer to the pod template of the workload
+		workload *meta_v1.ObjectMeta
+	)
+	if req.Kind.Kind == "Pod" && req.Kind.Group == "" {
+		pod = &core_v1.Pod{}
+		if err := json.Unmarshal(req.Object.Raw, pod); err != nil {
+			l.Error("Failed to decode raw object for pod",
+				zap.Error(err),
+			)
+			res.Result = &meta_v1.Status{Message: err.Error()}
+			return res
+		}
+		if pod.Namespace == "" {
+			pod.Namespace = req.Namespace
+		}
+	} else {
+		var err error
+		pod, workload, template, err = workloadTemplate(req)
+		switch {
+		case errors.Is(err, errUnsupportedWorkload):
+			l.Warn("Received admission request for unsupported object => skipping...",
+				zap.String("group", req.Kind.Group),
+				zap.String("kind", req.Kind.Kind),
+			)
+			return res
+		case errors.Is(err, errJobTemplateImmutable):
+			l.Debug("Job template can not be changed on update => skipping...",
+				zap.String("namespace", req.Namespace),
+				zap.String("job", req.Name),
+			)
+			return res
+		case errors.Is(err, errWorkloadOfCronJob):
+			l.Info("Job is created from the template of the cron-job => skipping...",
+				zap.String("namespace", req.Namespace),
+				zap.String("job", req.Name),
+			)
+			return res
+		case err != nil:
+			l.Error("Failed to decode raw object for workload",
+				zap.Error(err),
+			)
+			res.Result = &meta_v1.Status{Message: err.Error()}
+			return res
+		}
 	}
 
 	podName := pod.ObjectMeta.Name
@@ -184,15 +406,91 @@ func (s *Server) mutate(
 		zap.Any("pod", pod),
 	)
 
-	patches, err := s.mutatePod(ctx, pod, fingerprint)
+	// on-demand rules are checked one-by-one (see mutateOnDemand)
+	if fingerprint != onDemandFingerprint && !s.matchesUserInfo(ctx, fingerprint, &req.UserInfo) {
+		return res
+	}
+
+	var (
+		patches  json_patch.Patch
+		warnings []string
+		err      error
+	)
+	switch {
+	case fingerprint == onDemandFingerprint:
+		if template != "" || req.SubResource != "" {
+			l.Warn("Received admission request for on-demand injection into something else than a pod => skipping...")
+			return res
+		}
+		patches, warnings, err = s.mutateOnDemand(ctx, req, pod)
+		res.Warnings = append(res.Warnings, warnings...)
+	case template != "" || req.SubResource == "":
+		var spec map[string]interface{}
+		if spec, err = rawPodSpec(req.Object.Raw, template); err == nil {
+			patches, err = s.mutatePod(ctx, pod, spec, fingerprint, workload, req.Operation)
+		}
+	case req.SubResource == "ephemeralcontainers":
+		oldPod := &core_v1.Pod{}
+		if err := json.Unmarshal(req.OldObject.Raw, oldPod); err != nil {
+			l.Error("Failed to decode raw old object for pod",
+				zap.Error(err),
+			)
+			res.Result = &meta_v1.Status{Message: err.Error()}
+			return res
+		}
+		patches, err = s.mutateEphemeralContainers(ctx, pod, oldPod, fingerprint)
+	default:
+		l.Warn("Received admission request for unsupported pod sub-resource => skipping...",
+			zap.String("subResource", req.SubResource),
+		)
+		return res
+	}
+	if errors.Is(err, patch.ErrConflict) {
+		l.Warn("Denying admission of the pod due to the conflict",
+			zap.Error(err),
+		)
+		res.Allowed = false
+		res.Result = &meta_v1.Status{
+			Status:  meta_v1.StatusFailure,
+			Message: err.Error(),
+			Reason:  meta_v1.StatusReasonConflict,
+			Code:    http.StatusConflict,
+		}
+		return res
+	}
+	if errors.Is(err, errAtomicInjectSkipped) {
+		l.Warn("Skipping the pod",
+			zap.Error(err),
+		)
+		res.Warnings = append(res.Warnings, err.Error())
+		return res
+	}
 	if err != nil {
 		l.Error("Failed to mutate pod",
 			zap.Error(err),
 		)
 		res.Result = &meta_v1.Status{Message: err.Error()}
+		res.Warnings = append(res.Warnings, "failed to mutate pod: "+err.Error())
 		return res
 	}
 	if len(patches) > 0 {
+		if template != "" {
+			if patches, err = templatePatch(req.Object.Raw, template, patches); err != nil {
+				l.Error("Failed to move the patch under the pod template",
+					zap.Error(err),
+				)
+				res.Result = &meta_v1.Status{Message: err.Error()}
+				return res
+			}
+		}
+		if err := validatePatch(req, template, pod, patches); err != nil {
+			l.Error("Generated patch is invalid => skipping...",
+				zap.Error(err),
+			)
+			res.Warnings = append(res.Warnings, err.Error())
+			return res
+		}
+
 		b, err := json.Marshal(patches)
 		if err != nil {
 			l.Error("Failed to encode pod patches",
@@ -213,14 +511,22 @@ func (s *Server) mutate(
 	return res
 }
 
+// mutatePod generates the patch for the pod.  With `workload` set, the pod is
+// the pod template of that workload (see workloadTemplate).  The `spec` is the
+// pod spec as it came in the request (see rawPodSpec).  On the updates of the
+// pods only labels and annotations are injected.
 func (s *Server) mutatePod(
 	ctx context.Context,
 	pod *core_v1.Pod,
+	spec map[string]interface{},
 	fingerprint string,
+	workload *meta_v1.ObjectMeta,
+	operation admission_v1.Operation,
 ) (
 	json_patch.Patch, error,
 ) {
 	l := logutils.LoggerFromContext(ctx)
+	template := workload != nil
 
 	inject, exists := s.inject[fingerprint]
 	if !exists {
@@ -234,6 +540,123 @@ func (s *Server) mutatePod(
 		)
 	}
 
+	if !inject.Operations.Allows(string(operation)) {
+		l.Debug("Operation is not selected by inject-configuration => skipping...",
+			zap.String("operation", string(operation)),
+		)
+		return nil, nil
+	}
+
+	annotationTemplate := s.cfg.K8S.ServiceName + "." + global.OrgDomain + "/" + fingerprint + ".template"
+	if _, fromTemplate := pod.Annotations[annotationTemplate]; fromTemplate && !template {
+		l.Info("Pod comes from the already mutated template => skipping...")
+		return nil, nil
+	}
+
+	if in, explicit := s.optedIn(ctx, inject, pod); !in {
+		if explicit {
+			l.Info("Pod (or its namespace) opted out of the injection => skipping...")
+		} else {
+			l.Debug("Pod (or its namespace) did not opt in the injection => skipping...")
+		}
+		return nil, nil
+	}
+
+	if template {
+		// the webhook for the workloads matches any labels
+		matches, err := matchesSelector(inject.LabelSelector, pod.Labels)
+		if err != nil {
+			return nil, err
+		}
+		if !matches {
+			l.Debug("Pod template does not match the label selector => skipping...")
+			return nil, nil
+		}
+	}
+
+	if inject.OwnerKinds != nil {
+		kind, err := s.ownerKind(ctx, inject.OwnerKinds, pod)
+		if err != nil {
+			l.Warn("Failed to resolve the owner of the pod => skipping...",
+				zap.Error(err),
+			)
+			return nil, nil
+		}
+		if !inject.OwnerKinds.Matches(kind) {
+			l.Debug("Pod owner kind is not selected by inject-configuration => skipping...",
+				zap.String("ownerKind", kind),
+			)
+			return nil, nil
+		}
+	}
+
+	if inject.OwnerSelector != nil {
+		owner, _, err := s.topOwner(ctx, pod, workload)
+		if err != nil {
+			l.Warn("Failed to resolve the owner of the pod => skipping...",
+				zap.Error(err),
+			)
+			return nil, nil
+		}
+		matches, err := matchesOwnerSelector(inject.OwnerSelector, owner)
+		if err != nil {
+			return nil, err
+		}
+		if !matches {
+			l.Debug("Pod owner does not match the owner selector => skipping...")
+			return nil, nil
+		}
+	}
+
+	if !inject.Matches(pod) {
+		l.Debug("Pod does not satisfy the predicates of inject-configuration => skipping...")
+		return nil, nil
+	}
+
+	if inject.Rollout != nil {
+		owner, err := s.rolloutOwner(ctx, pod, workload)
+		if err != nil {
+			l.Warn("Failed to resolve the owner of the pod for the rollout => skipping...",
+				zap.Error(err),
+			)
+			return nil, nil
+		}
+		bucket := inject.Rollout.Bucket(inject.Name, pod.Namespace, owner)
+		selected := inject.Rollout.Selects(pod.Namespace, bucket)
+		l.Info("Resolved rollout bucket of the pod",
+			zap.String("rolloutOwner", owner),
+			zap.Int("rolloutBucket", bucket),
+			zap.Int("rolloutPercentage", inject.Rollout.Percentage),
+			zap.Bool("rolloutSelected", selected),
+		)
+		countRolloutDecision(inject, fingerprint, selected)
+		if !selected {
+			l.Debug("Pod is not selected for the rollout of inject-configuration => skipping...")
+			return nil, nil
+		}
+	}
+
+	inject, err := render.Inject(inject, pod, resolveParameters(ctx, inject, pod))
+	if err != nil {
+		l.Warn("Failed to render inject-configuration for the pod => skipping...",
+			zap.Error(err),
+		)
+		return nil, nil
+	}
+
+	if operation == admission_v1.Update && !template {
+		// spec of the existing pod is (mostly) immutable
+		inject = inject.Metadata()
+	}
+
+	var jobSidecars string
+	if inject.Jobs != nil && ownedByJob(pod) {
+		jobSidecars = s.jobSidecars(inject.Jobs)
+		l = l.With(
+			zap.String("jobSidecars", jobSidecars),
+		)
+	}
+
 	res := make(json_patch.Patch, 0)
 
 	// inject affinity
@@ -248,189 +671,432 @@ func (s *Server) mutatePod(
 		res = append(res, p...)
 	}
 
-	// inject volumes
-	if len(inject.Volumes) > 0 {
-		existing := make(map[string]struct{}, len(pod.Spec.Volumes))
-		for _, v := range pod.Spec.Volumes {
-			existing[v.Name] = struct{}{}
-		}
+	native := inject.Native
+	if native == nil {
+		native = &config.InjectNative{}
+	}
 
-		volumes := make([]core_v1.Volume, 0, len(inject.Volumes))
+	// inject volumes
+	if len(inject.Volumes)+len(native.Volumes) > 0 {
+		volumes := make([]core_v1.Volume, 0, len(inject.Volumes)+len(native.Volumes))
+		policies := make([]config.ConflictPolicy, 0, len(inject.Volumes)+len(native.Volumes))
 		for _, v := range inject.Volumes {
-			if _, collision := existing[v.Name]; collision {
-				l.Warn("Volume with the same name already exists => skipping...",
-					zap.String("volume", v.Name),
-				)
-				continue
-			}
-
-			l.Info("Injecting volume",
-				zap.String("volume", v.Name),
-			)
 			volume, err := v.Volume()
 			if err != nil {
 				return nil, err
 			}
 			volumes = append(volumes, *volume)
+			policies = append(policies, inject.ConflictPolicy(v.OnConflict))
+		}
+		for _, v := range native.Volumes {
+			volumes = append(volumes, v)
+			policies = append(policies, inject.ConflictPolicy(""))
 		}
 
-		p, err := patch.InsertPodVolumes(pod, volumes)
+		p, conflicts, err := patch.InsertPodVolumes(pod, volumes, policies)
 		if err != nil {
 			return nil, err
 		}
+		logConflicts(l, conflicts)
+		if err := checkAtomic(inject, conflicts); err != nil {
+			return nil, err
+		}
+		for _, v := range volumes {
+			if !hasConflict(conflicts, v.Name) {
+				l.Info("Injecting volume",
+					zap.String("volume", v.Name),
+				)
+			}
+		}
 		res = append(res, p...)
 	}
 
 	// inject volume mounts
-	if len(inject.VolumeMounts) > 0 {
-		for idx, c := range pod.Spec.InitContainers {
-			existing := make(map[string]struct{}, len(c.VolumeMounts))
-			for _, vm := range c.VolumeMounts {
-				existing[vm.MountPath] = struct{}{}
+	if len(inject.VolumeMounts)+len(native.VolumeMounts) > 0 {
+		candidates := make([]core_v1.VolumeMount, 0, len(inject.VolumeMounts)+len(native.VolumeMounts))
+		candidatePolicies := make([]config.ConflictPolicy, 0, len(inject.VolumeMounts)+len(native.VolumeMounts))
+		candidateSelectors := make([]*config.InjectContainerSelector, 0, len(inject.VolumeMounts)+len(native.VolumeMounts))
+		for _, vm := range inject.VolumeMounts {
+			volumeMount, err := vm.VolumeMount()
+			if err != nil {
+				return nil, err
 			}
+			candidates = append(candidates, *volumeMount)
+			candidatePolicies = append(candidatePolicies, inject.ConflictPolicy(vm.OnConflict))
+			candidateSelectors = append(candidateSelectors, vm.Containers)
+		}
+		for _, vm := range native.VolumeMounts {
+			candidates = append(candidates, vm)
+			candidatePolicies = append(candidatePolicies, inject.ConflictPolicy(""))
+			candidateSelectors = append(candidateSelectors, nil)
+		}
 
-			volumeMounts := make([]core_v1.VolumeMount, 0, len(inject.VolumeMounts))
-			for _, vm := range inject.VolumeMounts {
-				if _, collision := existing[vm.MountPath]; collision {
-					l.Warn("Volume mount with the same mount path already exists in the init-container => skipping...",
+		for idx, c := range pod.Spec.InitContainers {
+			volumeMounts := make([]core_v1.VolumeMount, 0, len(candidates))
+			policies := make([]config.ConflictPolicy, 0, len(candidates))
+			for vmIdx, vm := range candidates {
+				if selector := candidateSelectors[vmIdx]; selector != nil && !selector.Matches(c.Name, c.Image) {
+					l.Debug("The init-container is not selected for the volume mount => skipping...",
 						zap.String("initContainer", c.Name),
 						zap.String("mountPath", vm.MountPath),
 					)
 					continue
 				}
-
-				l.Info("Injecting volume mount into the init-container",
-					zap.String("initContainer", c.Name),
-					zap.String("volumeMount", vm.Name),
-				)
-				volumeMount, err := vm.VolumeMount()
-				if err != nil {
-					return nil, err
-				}
-				volumeMounts = append(volumeMounts, *volumeMount)
+				volumeMounts = append(volumeMounts, vm)
+				policies = append(policies, candidatePolicies[vmIdx])
 			}
 
-			p, err := patch.InsertInitContainerVolumeMounts(idx, &c, volumeMounts)
+			p, conflicts, err := patch.InsertInitContainerVolumeMounts(idx, &c, volumeMounts, policies)
 			if err != nil {
 				return nil, err
 			}
+			logConflicts(l, conflicts)
+			if err := checkAtomic(inject, conflicts); err != nil {
+				return nil, err
+			}
+			for _, vm := range volumeMounts {
+				if !hasConflict(conflicts, vm.MountPath) {
+					l.Info("Injecting volume mount into the init-container",
+						zap.String("initContainer", c.Name),
+						zap.String("volumeMount", vm.Name),
+					)
+				}
+			}
 			res = append(res, p...)
 		}
 
 		for idx, c := range pod.Spec.Containers {
-			existing := make(map[string]struct{}, len(c.VolumeMounts))
-			for _, vm := range c.VolumeMounts {
-				existing[vm.MountPath] = struct{}{}
-			}
-
-			volumeMounts := make([]core_v1.VolumeMount, 0, len(inject.VolumeMounts))
-			for _, vm := range inject.VolumeMounts {
-				if _, collision := existing[vm.MountPath]; collision {
-					l.Warn("Volume mount with the same mount path already exists in the container => skipping...",
+			volumeMounts := make([]core_v1.VolumeMount, 0, len(candidates))
+			policies := make([]config.ConflictPolicy, 0, len(candidates))
+			for vmIdx, vm := range candidates {
+				if selector := candidateSelectors[vmIdx]; selector != nil && !selector.Matches(c.Name, c.Image) {
+					l.Debug("The container is not selected for the volume mount => skipping...",
 						zap.String("container", c.Name),
 						zap.String("mountPath", vm.MountPath),
 					)
 					continue
 				}
+				volumeMounts = append(volumeMounts, vm)
+				policies = append(policies, candidatePolicies[vmIdx])
+			}
 
-				l.Info("Injecting volume mount into the container",
-					zap.String("container", c.Name),
-					zap.String("volumeMount", vm.Name),
-				)
-				volumeMount, err := vm.VolumeMount()
-				if err != nil {
-					return nil, err
-				}
-				volumeMounts = append(volumeMounts, *volumeMount)
-			}
-
-			p, err := patch.InsertContainerVolumeMounts(idx, &c, volumeMounts)
+			p, conflicts, err := patch.InsertContainerVolumeMounts(idx, &c, volumeMounts, policies)
 			if err != nil {
 				return nil, err
 			}
+			logConflicts(l, conflicts)
+			if err := checkAtomic(inject, conflicts); err != nil {
+				return nil, err
+			}
+			for _, vm := range volumeMounts {
+				if !hasConflict(conflicts, vm.MountPath) {
+					l.Info("Injecting volume mount into the container",
+						zap.String("container", c.Name),
+						zap.String("volumeMount", vm.Name),
+					)
+				}
+			}
 			res = append(res, p...)
 		}
 	}
 
 	// inject containers
-	if len(inject.Containers) > 0 {
+	var injectedContainers []core_v1.Container
+	if len(inject.Containers)+len(native.Containers) > 0 {
 		existing := make(map[string]struct{}, len(pod.Spec.Containers))
 		for _, c := range pod.Spec.Containers {
 			existing[c.Name] = struct{}{}
 		}
 
-		containers := make([]core_v1.Container, 0, len(inject.Containers))
+		candidates := make([]core_v1.Container, 0, len(inject.Containers)+len(native.Containers))
+		candidatePositions := make([]config.InjectContainerPosition, 0, len(inject.Containers)+len(native.Containers))
+		candidatePolicies := make([]config.ConflictPolicy, 0, len(inject.Containers)+len(native.Containers))
 		for _, c := range inject.Containers {
-			if _, collision := existing[c.Name]; collision {
-				l.Warn("Container with the same name already exists => skipping...",
+			container, err := c.Container()
+			if err != nil {
+				return nil, err
+			}
+			if c.Resources != nil && c.Resources.Relative != nil {
+				relative, err := c.Resources.Relative.ResourceRequirements(pod)
+				if err != nil {
+					return nil, err
+				}
+				for name, q := range relative.Limits {
+					container.Resources.Limits[name] = q
+				}
+				for name, q := range relative.Requests {
+					container.Resources.Requests[name] = q
+				}
+				l.Info("Computed relative resources of the container",
 					zap.String("container", c.Name),
+					zap.Any("limits", relative.Limits),
+					zap.Any("requests", relative.Requests),
 				)
+				// computed values could cross the fixed ones, and k8s rejects
+				// the requests that exceed the limits
+				for name, request := range container.Resources.Requests {
+					if limit, limited := container.Resources.Limits[name]; limited && request.Cmp(limit) > 0 {
+						l.Warn("Resource request of the container exceeds its limit => clamping...",
+							zap.String("container", c.Name),
+							zap.String("resource", string(name)),
+							zap.String("request", request.String()),
+							zap.String("limit", limit.String()),
+						)
+						container.Resources.Requests[name] = limit
+					}
+				}
+			}
+			candidates = append(candidates, *container)
+			candidatePositions = append(candidatePositions, c.Position)
+			candidatePolicies = append(candidatePolicies, inject.ConflictPolicy(c.OnConflict))
+		}
+		for _, c := range native.Containers {
+			candidates = append(candidates, c)
+			candidatePositions = append(candidatePositions, config.ContainerPositionLast)
+			candidatePolicies = append(candidatePolicies, inject.ConflictPolicy(""))
+		}
+
+		var (
+			p         json_patch.Patch
+			conflicts []patch.Conflict
+		)
+		if jobSidecars == config.JobSidecarsNative {
+			always := core_v1.ContainerRestartPolicyAlways
+			for idx := range candidates {
+				candidates[idx].RestartPolicy = &always
+			}
+			p, conflicts, err = patch.InsertPodInitContainers(pod, candidates, candidatePolicies)
+		} else {
+			p, conflicts, err = patch.InsertPodContainers(pod, candidates, candidatePositions, candidatePolicies)
+		}
+		if err != nil {
+			return nil, err
+		}
+		logConflicts(l, conflicts)
+		if err := checkAtomic(inject, conflicts); err != nil {
+			return nil, err
+		}
+
+		for idx, c := range candidates {
+			if hasConflict(conflicts, c.Name) {
 				continue
 			}
 
+			position := candidatePositions[idx]
+			if _, relativeTo, _ := position.Parse(); relativeTo != "" {
+				if _, found := existing[relativeTo]; !found {
+					l.Warn("Container to position relative to does not exist => appending...",
+						zap.String("container", c.Name),
+						zap.String("position", string(position)),
+					)
+				}
+			}
+
 			l.Info("Injecting container",
 				zap.String("container", c.Name),
+				zap.String("position", string(position)),
 			)
-			container, err := c.Container()
-			if err != nil {
-				return nil, err
-			}
-			containers = append(containers, *container)
+			injectedContainers = append(injectedContainers, c)
+			existing[c.Name] = struct{}{}
 		}
+		res = append(res, p...)
+	}
 
-		p, err := patch.InsertPodContainers(pod, containers)
+	// make the injected containers exit along with the job
+	if jobSidecars == config.JobSidecarsWrapper && len(injectedContainers) > 0 {
+		raw, err := json.Marshal(pod)
 		if err != nil {
 			return nil, err
 		}
-		res = append(res, p...)
+		_, current, err := applyPatch(raw, res)
+		if err != nil {
+			return nil, err
+		}
+
+		sidecars := make([]string, 0, len(injectedContainers))
+		for _, c := range injectedContainers {
+			sidecars = append(sidecars, c.Name)
+		}
+
+		p, err := patch.WrapJobContainers(current, sidecars)
+		switch {
+		case errors.Is(err, patch.ErrCommandNotSet):
+			// the rest of the rule still applies, only the injected
+			// containers will not exit along with the job
+			l.Warn("Can not wrap the containers of the job => injecting without the wrappers...",
+				zap.Error(err),
+			)
+			countJobWrappingSkipped(inject, fingerprint)
+		case err != nil:
+			return nil, err
+		default:
+			l.Info("Wrapping the containers of the job")
+			res = append(res, p...)
+		}
 	}
 
-	// inject tolerations
-	if len(inject.Tolerations) > 0 {
-		existing := make(map[string]struct{}, len(pod.Spec.Tolerations))
-		for _, t := range pod.Spec.Tolerations {
-			existing[t.Key] = struct{}{}
+	// check fargate capacity
+	var fargateTier string
+	if inject.Fargate != nil {
+		before, err := fargate.PodCapacity(&pod.Spec)
+		if err != nil {
+			l.Warn("Pod does not fit into fargate even before the injection",
+				zap.Error(err),
+			)
 		}
 
-		tolerations := make([]core_v1.Toleration, 0, len(pod.Spec.Tolerations))
-		for _, t := range inject.Tolerations {
-			if _, collision := existing[t.Key]; collision {
-				l.Warn("Toleration with the same key already exists => skipping...",
-					zap.String("key", t.Key),
+		spec := pod.Spec.DeepCopy()
+		spec.Containers = append(spec.Containers, injectedContainers...)
+		after, err := fargate.PodCapacity(spec)
+
+		if err != nil || (before != nil && before.String() != after.String()) {
+			var tierBefore, tierAfter string
+			if before != nil {
+				tierBefore = before.String()
+			}
+			if after != nil {
+				tierAfter = after.String()
+			}
+
+			if inject.Fargate.OnTierChange == config.FargateOnTierChangeSkip {
+				l.Warn("Injection changes fargate tier of the pod => skipping...",
+					zap.String("tierBefore", tierBefore),
+					zap.String("tierAfter", tierAfter),
+					zap.Error(err),
 				)
-				continue
+				return nil, nil
 			}
 
-			l.Info("Injecting toleration",
-				zap.String("key", t.Key),
+			l.Warn("Injection changes fargate tier of the pod",
+				zap.String("tierBefore", tierBefore),
+				zap.String("tierAfter", tierAfter),
+				zap.Error(err),
 			)
+		}
+
+		if after != nil {
+			fargateTier = after.String()
+		}
+	}
+
+	// inject tolerations
+	if len(inject.Tolerations)+len(native.Tolerations) > 0 {
+		tolerations := make([]core_v1.Toleration, 0, len(inject.Tolerations)+len(native.Tolerations))
+		policies := make([]config.ConflictPolicy, 0, len(inject.Tolerations)+len(native.Tolerations))
+		for _, t := range inject.Tolerations {
 			toleration, err := t.Toleration()
 			if err != nil {
 				return nil, err
 			}
 			tolerations = append(tolerations, *toleration)
+			policies = append(policies, inject.ConflictPolicy(t.OnConflict))
+		}
+		for _, t := range native.Tolerations {
+			tolerations = append(tolerations, t)
+			policies = append(policies, inject.ConflictPolicy(""))
 		}
 
-		p, err := patch.InsertTolerations(pod, tolerations)
+		p, conflicts, err := patch.InsertTolerations(pod, tolerations, policies)
 		if err != nil {
 			return nil, err
 		}
+		logConflicts(l, conflicts)
+		if err := checkAtomic(inject, conflicts); err != nil {
+			return nil, err
+		}
+		for _, t := range tolerations {
+			if !hasConflict(conflicts, t.Key) {
+				l.Info("Injecting toleration",
+					zap.String("key", t.Key),
+				)
+			}
+		}
 		res = append(res, p...)
 	}
 
+	// inject pod-level toggles
+	{
+		// the plain bool is unset the same way as it is set to false => tell
+		// them apart by the raw spec (so that the conflict policy applies to
+		// the explicit false too)
+		var hostPID *bool
+		if _, set := spec["hostPID"]; set || pod.Spec.HostPID {
+			hostPID = &pod.Spec.HostPID
+		}
+
+		for _, t := range []struct {
+			field        string
+			current      *bool
+			defaultValue bool
+			toggle       *config.InjectPodToggle
+		}{
+			{"automountServiceAccountToken", pod.Spec.AutomountServiceAccountToken, true, inject.AutomountServiceAccountToken},
+			{"enableServiceLinks", pod.Spec.EnableServiceLinks, true, inject.EnableServiceLinks},
+			{"hostPID", hostPID, false, inject.HostPID},
+			{"shareProcessNamespace", pod.Spec.ShareProcessNamespace, false, inject.ShareProcessNamespace},
+		} {
+			if t.toggle == nil {
+				continue
+			}
+
+			p, conflicts, err := patch.UpsertPodToggle(t.field, t.current, t.defaultValue, t.toggle, inject.ConflictPolicy(t.toggle.OnConflict))
+			if err != nil {
+				return nil, err
+			}
+			logConflicts(l, conflicts)
+			if err := checkAtomic(inject, conflicts); err != nil {
+				return nil, err
+			}
+			if len(p) > 0 && t.current == nil {
+				l.Info("Injecting toggle",
+					zap.String("toggle", t.field),
+					zap.Bool("value", t.toggle.Value),
+				)
+			}
+			res = append(res, p...)
+		}
+	}
+
 	{ // inject labels
-		p, err := patch.InsertPodLabels(pod, inject.Labels)
+		p, conflicts, err := patch.InsertPodLabels(pod, inject.Labels, inject.ConflictPolicy(""))
 		if err != nil {
 			return nil, err
 		}
+		logConflicts(l, conflicts)
+		if err := checkAtomic(inject, conflicts); err != nil {
+			return nil, err
+		}
 		res = append(res, p...)
 	}
 
-	if len(res) == 0 {
+	// inject annotations (they are applied together with the circuit-breaker ones)
+	var injectedAnnotations json_patch.Patch
+	{
+		p, conflicts, err := patch.InsertPodAnnotations(pod, inject.Annotations, inject.ConflictPolicy(""))
+		if err != nil {
+			return nil, err
+		}
+		logConflicts(l, conflicts)
+		if err := checkAtomic(inject, conflicts); err != nil {
+			return nil, err
+		}
+		injectedAnnotations = p
+	}
+
+	if len(res) == 0 && len(injectedAnnotations) == 0 {
 		l.Info("Empty patch produced for the pod => skipping...")
 		return nil, nil
 	}
 
+	annotations := make(map[string]string, len(inject.Annotations)+4) // the ones of the injector itself
+
+	// the tier is only recorded along with the changes of the rule (on its
+	// own it would make the patch of the pod that nothing was injected into)
+	annotationFargateTier := s.cfg.K8S.ServiceName + "." + global.OrgDomain + "/fargate-tier"
+	if fargateTier != "" && pod.Annotations[annotationFargateTier] != fargateTier {
+		annotations[annotationFargateTier] = fargateTier
+	}
+
 	{ // circuit break
 		iterationsCount := 0
 
@@ -452,10 +1118,25 @@ func (s *Server) mutatePod(
 		}
 
 		iterationsCount += 1
-		p, err := patch.UpsertPodAnnotations(pod, map[string]string{
-			annotationIterationsCount:    strconv.Itoa(iterationsCount),
-			annotationProcessedTimestamp: time.Now().Format(time.RFC3339),
-		})
+		annotations[annotationIterationsCount] = strconv.Itoa(iterationsCount)
+		if template {
+			annotations[annotationTemplate] = "true"
+		}
+		annotations[annotationProcessedTimestamp] = time.Now().Format(time.RFC3339)
+
+		if len(pod.Annotations) == 0 {
+			// both patches would add the whole annotations map, and the latter
+			// would overwrite the former => combine them
+			for k, v := range inject.Annotations {
+				if _, exists := annotations[k]; !exists {
+					annotations[k] = v
+				}
+			}
+		} else {
+			res = append(res, injectedAnnotations...)
+		}
+
+		p, err := patch.UpsertPodAnnotations(pod, annotations)
 		if err != nil {
 			return nil, err
 		}
@@ -466,3 +1147,244 @@ func (s *Server) mutatePod(
 
 	return res, nil
 }
+
+func (s *Server) mutateEphemeralContainers(
+	ctx context.Context,
+	pod, oldPod *core_v1.Pod,
+	fingerprint string,
+) (
+	json_patch.Patch, error,
+) {
+	l := logutils.LoggerFromContext(ctx)
+
+	inject, exists := s.inject[fingerprint]
+	if !exists {
+		l.Warn("Unknown inject-configuration fingerprint => skipping...")
+		return nil, nil
+	}
+
+	if inject.Name != "" {
+		l = l.With(
+			zap.String("webhookInjectName", inject.Name),
+		)
+	}
+
+	if inject.EphemeralContainers == nil {
+		return nil, nil
+	}
+
+	inject, err := render.Inject(inject, pod, resolveParameters(ctx, inject, pod))
+	if err != nil {
+		l.Warn("Failed to render inject-configuration for the pod => skipping...",
+			zap.Error(err),
+		)
+		return nil, nil
+	}
+
+	// only the containers that are being added can be mutated
+	existing := make(map[string]struct{}, len(oldPod.Spec.EphemeralContainers))
+	for _, c := range oldPod.Spec.EphemeralContainers {
+		existing[c.Name] = struct{}{}
+	}
+
+	volumes := make(map[string]struct{}, len(pod.Spec.Volumes))
+	for _, v := range pod.Spec.Volumes {
+		volumes[v.Name] = struct{}{}
+	}
+
+	var securityContext *core_v1.SecurityContext
+	if inject.EphemeralContainers.SecurityContext != nil {
+		var err error
+		if securityContext, err = inject.EphemeralContainers.SecurityContext.SecurityContext(); err != nil {
+			return nil, err
+		}
+	}
+
+	res := make(json_patch.Patch, 0)
+
+	for idx, c := range pod.Spec.EphemeralContainers {
+		if _, old := existing[c.Name]; old {
+			continue
+		}
+
+		{ // inject env
+			existing := make(map[string]struct{}, len(c.Env))
+			for _, ev := range c.Env {
+				existing[ev.Name] = struct{}{}
+			}
+
+			env := make([]core_v1.EnvVar, 0, len(inject.EphemeralContainers.Env))
+			for _, ev := range inject.EphemeralContainers.Env {
+				if _, collision := existing[ev.Name]; collision {
+					l.Warn("Env var with the same name already exists in the ephemeral container => skipping...",
+						zap.String("ephemeralContainer", c.Name),
+						zap.String("envVar", ev.Name),
+					)
+					continue
+				}
+
+				l.Info("Injecting env var into the ephemeral container",
+					zap.String("ephemeralContainer", c.Name),
+					zap.String("envVar", ev.Name),
+				)
+				envVar, err := ev.EnvVar()
+				if err != nil {
+					return nil, err
+				}
+				env = append(env, *envVar)
+			}
+
+			p, err := patch.InsertEphemeralContainerEnv(idx, &c, env)
+			if err != nil {
+				return nil, err
+			}
+			res = append(res, p...)
+		}
+
+		{ // inject volume mounts
+			existing := make(map[string]struct{}, len(c.VolumeMounts))
+			for _, vm := range c.VolumeMounts {
+				existing[vm.MountPath] = struct{}{}
+			}
+
+			volumeMounts := make([]core_v1.VolumeMount, 0, len(inject.EphemeralContainers.VolumeMounts))
+			for _, vm := range inject.EphemeralContainers.VolumeMounts {
+				if vm.Containers != nil && !vm.Containers.Matches(c.Name, c.Image) {
+					l.Debug("The ephemeral container is not selected for the volume mount => skipping...",
+						zap.String("ephemeralContainer", c.Name),
+						zap.String("mountPath", vm.MountPath),
+					)
+					continue
+				}
+				if _, collision := existing[vm.MountPath]; collision {
+					l.Warn("Volume mount with the same mount path already exists in the ephemeral container => skipping...",
+						zap.String("ephemeralContainer", c.Name),
+						zap.String("mountPath", vm.MountPath),
+					)
+					continue
+				}
+				if _, found := volumes[vm.Name]; !found {
+					// volumes can not be added via ephemeralcontainers sub-resource
+					l.Warn("Volume to mount does not exist in the pod => skipping...",
+						zap.String("ephemeralContainer", c.Name),
+						zap.String("volume", vm.Name),
+					)
+					continue
+				}
+
+				l.Info("Injecting volume mount into the ephemeral container",
+					zap.String("ephemeralContainer", c.Name),
+					zap.String("volumeMount", vm.Name),
+				)
+				volumeMount, err := vm.VolumeMount()
+				if err != nil {
+					return nil, err
+				}
+				volumeMounts = append(volumeMounts, *volumeMount)
+			}
+
+			p, err := patch.InsertEphemeralContainerVolumeMounts(idx, &c, volumeMounts)
+			if err != nil {
+				return nil, err
+			}
+			res = append(res, p...)
+		}
+
+		{ // inject security context
+			p, err := patch.MergeEphemeralContainerSecurityContext(idx, &c, securityContext)
+			if err != nil {
+				return nil, err
+			}
+			if len(p) > 0 {
+				l.Info("Injecting security context into the ephemeral container",
+					zap.String("ephemeralContainer", c.Name),
+				)
+			}
+			res = append(res, p...)
+		}
+	}
+
+	if len(res) == 0 {
+		l.Info("Empty patch produced for the ephemeral containers => skipping...")
+		return nil, nil
+	}
+
+	l.Info("Processed ephemeral containers")
+
+	return res, nil
+}
+
+// matchesUserInfo checks the identity that makes the admission request against
+// the user info matchers of the rule.
+func (s *Server) matchesUserInfo(
+	ctx context.Context,
+	fingerprint string,
+	user *authentication_v1.UserInfo,
+) bool {
+	l := logutils.LoggerFromContext(ctx)
+
+	inject, exists := s.inject[fingerprint]
+	if !exists || inject.UserInfo == nil {
+		return true
+	}
+	if !inject.UserInfo.Matches(user) {
+		l.Info("Admission request by the user is not selected by inject-configuration => skipping...",
+			zap.String("injectName", inject.Name),
+			zap.String("username", user.Username),
+			zap.Strings("groups", user.Groups),
+		)
+		return false
+	}
+	return true
+}
+
+func logConflicts(l *zap.Logger, conflicts []patch.Conflict) {
+	for _, c := range conflicts {
+		fields := []zap.Field{
+			zap.String("element", c.Element),
+			zap.String("name", c.Name),
+		}
+		if c.Container != "" {
+			fields = append(fields, zap.String("container", c.Container))
+		}
+
+		if c.Identical {
+			l.Debug("Element already exists in the pod as is => skipping...", fields...)
+			continue
+		}
+
+		switch c.Policy {
+		case config.ConflictPolicyOverride:
+			l.Info("Overriding the element that already exists in the pod", fields...)
+		case config.ConflictPolicyMerge:
+			l.Info("Merging into the element that already exists in the pod", fields...)
+		default:
+			l.Warn("Element already exists in the pod => skipping...", fields...)
+		}
+	}
+}
+
+func hasConflict(conflicts []patch.Conflict, name string) bool {
+	for _, c := range conflicts {
+		if c.Name == name {
+			return true
+		}
+	}
+	return false
+}
+
+// checkAtomic returns an error if the inject-configuration is atomic, and some
+// of its elements were skipped due to the conflicts.
+func checkAtomic(inject *config.Inject, conflicts []patch.Conflict) error {
+	if !inject.Atomic {
+		return nil
+	}
+	for _, c := range conflicts {
+		if c.Policy == config.ConflictPolicySkip && !c.Identical {
+			return fmt.Errorf("%w: %s: %s '%s' already exists in the pod",
+				errAtomicInjectSkipped, inject.Name, c.Element, c.Name,
+			)
+		}
+	}
+	return nil
+}
@@ -0,0 +1,52 @@
+package server
+
+import (
+	"github.com/flashbots/kube-sidecar-injector/config"
+	"github.com/prometheus/client_golang/prometheus"
+)
+
+const (
+	metricsNamespace = "kube_sidecar_injector"
+)
+
+var (
+	metricRolloutDecisions = prometheus.NewCounterVec(prometheus.CounterOpts{
+		Namespace: metricsNamespace,
+		Name:      "rollout_decisions_total",
+		Help:      "Count of the rollout decisions by the inject-configuration and the decision (selected or skipped).",
+	}, []string{"inject", "decision"})
+
+	metricJobWrappingSkipped = prometheus.NewCounterVec(prometheus.CounterOpts{
+		Namespace: metricsNamespace,
+		Name:      "job_wrapping_skipped_total",
+		Help:      "Count of the job pods which containers could not be wrapped (the ones that do not set the command) by the inject-configuration.",
+	}, []string{"inject"})
+)
+
+func init() {
+	prometheus.MustRegister(metricRolloutDecisions)
+	prometheus.MustRegister(metricJobWrappingSkipped)
+}
+
+// countRolloutDecision counts the rollout decision of the rule.
+func countRolloutDecision(inject *config.Inject, fingerprint string, selected bool) {
+	decision := "skipped"
+	if selected {
+		decision = "selected"
+	}
+	metricRolloutDecisions.WithLabelValues(metricsInjectName(inject, fingerprint), decision).Inc()
+}
+
+// countJobWrappingSkipped counts the job pods that the rule could not wrap.
+func countJobWrappingSkipped(inject *config.Inject, fingerprint string) {
+	metricJobWrappingSkipped.WithLabelValues(metricsInjectName(inject, fingerprint)).Inc()
+}
+
+// metricsInjectName labels the metrics of the rule (the unnamed rules are
+// labelled with their fingerprints).
+func metricsInjectName(inject *config.Inject, fingerprint string) string {
+	if inject.Name == "" {
+		return fingerprint
+	}
+	return inject.Name
+}
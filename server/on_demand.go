@@ -0,0 +1,116 @@
+package server
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"strings"
+
+	json_patch "github.com/evanphx/json-patch"
+	"github.com/flashbots/kube-sidecar-injector/global"
+	"github.com/flashbots/kube-sidecar-injector/logutils"
+	"go.uber.org/zap"
+	admission_v1 "k8s.io/api/admission/v1"
+	core_v1 "k8s.io/api/core/v1"
+)
+
+const (
+	// onDemandFingerprint is the path suffix of the webhook for on-demand
+	// rules (it can not collide with the fingerprints as these are hex)
+	onDemandFingerprint = "on-demand"
+
+	// annotationOnDemand is the annotation with which pods request the
+	// on-demand rules (comma-separated names)
+	annotationOnDemand = global.AnnotationPrefix + "inject"
+)
+
+// mutateOnDemand applies the on-demand rules that are requested by the pod one
+// after another (each one sees the pod as patched by the previous ones).
+func (s *Server) mutateOnDemand(
+	ctx context.Context,
+	req *admission_v1.AdmissionRequest,
+	pod *core_v1.Pod,
+) (
+	json_patch.Patch, []string, error,
+) {
+	l := logutils.LoggerFromContext(ctx)
+	raw := req.Object.Raw
+
+	requested, set := pod.Annotations[annotationOnDemand]
+	if !set {
+		return nil, nil, nil
+	}
+
+	var (
+		res      = make(json_patch.Patch, 0)
+		warnings []string
+		seen     = make(map[string]struct{})
+	)
+
+	for _, name := range strings.Split(requested, ",") {
+		name = strings.TrimSpace(name)
+		if name == "" {
+			continue
+		}
+		if _, duplicate := seen[name]; duplicate {
+			continue
+		}
+		seen[name] = struct{}{}
+
+		fingerprint, known := s.onDemand[name]
+		if !known {
+			l.Warn("Pod requested unknown on-demand inject-configuration => skipping...",
+				zap.String("injectName", name),
+			)
+			warnings = append(warnings, fmt.Sprintf("unknown on-demand inject-configuration: %s", name))
+			continue
+		}
+
+		if !s.matchesUserInfo(ctx, fingerprint, &req.UserInfo) {
+			continue
+		}
+
+		matches, err := s.matchesSelectors(s.inject[fingerprint], pod)
+		if err != nil {
+			return nil, warnings, err
+		}
+		if !matches {
+			l.Info("Pod does not match the selectors of requested on-demand inject-configuration => skipping...",
+				zap.String("injectName", name),
+			)
+			continue
+		}
+
+		spec, err := rawPodSpec(raw, "")
+		if err != nil {
+			return nil, warnings, err
+		}
+		p, err := s.mutatePod(ctx, pod, spec, fingerprint, nil, req.Operation)
+		if errors.Is(err, errAtomicInjectSkipped) {
+			l.Warn("Skipping on-demand inject-configuration",
+				zap.String("injectName", name),
+				zap.Error(err),
+			)
+			warnings = append(warnings, err.Error())
+			continue
+		}
+		if err != nil {
+			return nil, warnings, err
+		}
+		if len(p) == 0 {
+			continue
+		}
+
+		// the next rule is applied on top of this one
+		namespace := pod.Namespace
+		if raw, pod, err = applyPatch(raw, p); err != nil {
+			return nil, warnings, err
+		}
+		if pod.Namespace == "" {
+			pod.Namespace = namespace
+		}
+		res = append(res, p...)
+	}
+
+	return res, warnings, nil
+}
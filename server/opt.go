@@ -0,0 +1,53 @@
+package server
+
+import (
+	"context"
+	"strconv"
+
+	"github.com/flashbots/kube-sidecar-injector/config"
+	"github.com/flashbots/kube-sidecar-injector/logutils"
+	"go.uber.org/zap"
+	core_v1 "k8s.io/api/core/v1"
+)
+
+// optedIn resolves whether the pod opted in (or out) of the injection by the
+// rule with the annotation.  The annotation of the pod wins over the one of
+// its namespace.  The `explicit` is false when neither of them is set.
+func (s *Server) optedIn(
+	ctx context.Context,
+	inject *config.Inject,
+	pod *core_v1.Pod,
+) (in, explicit bool) {
+	if inject.Name == "" {
+		return !inject.OptIn, false
+	}
+
+	l := logutils.LoggerFromContext(ctx)
+	annotation := inject.InjectAnnotation()
+
+	value, set := pod.Annotations[annotation]
+	if !set && !s.cfg.K8S.DisableNamespaceAnnotations && pod.Namespace != "" {
+		namespace, err := s.namespaces.Get(pod.Namespace)
+		if err != nil {
+			l.Warn("Failed to get the namespace of the pod",
+				zap.Error(err),
+			)
+		} else {
+			value, set = namespace.Annotations[annotation]
+		}
+	}
+	if !set {
+		return !inject.OptIn, false
+	}
+
+	in, err := strconv.ParseBool(value)
+	if err != nil {
+		l.Warn("Invalid value of the inject annotation => ignoring...",
+			zap.String("annotation", annotation),
+			zap.String("value", value),
+		)
+		return !inject.OptIn, false
+	}
+
+	return in, true
+}
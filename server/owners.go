@@ -0,0 +1,198 @@
+package server
+
+import (
+	"context"
+	"errors"
+	"fmt"
+
+	"github.com/flashbots/kube-sidecar-injector/config"
+	core_v1 "k8s.io/api/core/v1"
+	k8s_errors "k8s.io/apimachinery/pkg/api/errors"
+	meta_v1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/client-go/informers"
+	"k8s.io/client-go/kubernetes"
+	apps_v1_listers "k8s.io/client-go/listers/apps/v1"
+	batch_v1_listers "k8s.io/client-go/listers/batch/v1"
+)
+
+const (
+	// maxOwnerDepth limits the owner chain (cron-job => job => pod is the
+	// longest one among the supported kinds)
+	maxOwnerDepth = 4
+)
+
+var (
+	errFailedToLookUpOwner = errors.New("failed to look up the owner of the pod")
+	errOwnerChainTooLong   = errors.New("owner chain is too long")
+)
+
+// ownerListers look up the owners of the pods in the informer cache, and fall
+// back to k8s api for the ones that are not there yet (for example, the job
+// that the cron-job has just created).
+type ownerListers struct {
+	k8s kubernetes.Interface
+
+	cronJobs     batch_v1_listers.CronJobLister
+	daemonSets   apps_v1_listers.DaemonSetLister
+	deployments  apps_v1_listers.DeploymentLister
+	jobs         batch_v1_listers.JobLister
+	replicaSets  apps_v1_listers.ReplicaSetLister
+	statefulSets apps_v1_listers.StatefulSetLister
+}
+
+func newOwnerListers(factory informers.SharedInformerFactory, k8s kubernetes.Interface) *ownerListers {
+	return &ownerListers{
+		k8s: k8s,
+
+		cronJobs:     factory.Batch().V1().CronJobs().Lister(),
+		daemonSets:   factory.Apps().V1().DaemonSets().Lister(),
+		deployments:  factory.Apps().V1().Deployments().Lister(),
+		jobs:         factory.Batch().V1().Jobs().Lister(),
+		replicaSets:  factory.Apps().V1().ReplicaSets().Lister(),
+		statefulSets: factory.Apps().V1().StatefulSets().Lister(),
+	}
+}
+
+// get returns the owner from the informer cache or, if it is not there, from
+// k8s api (nil for the kinds that are not supported).
+func (o *ownerListers) get(ctx context.Context, namespace string, owner *meta_v1.OwnerReference) (meta_v1.Object, error) {
+	obj, err := o.cached(namespace, owner)
+	if k8s_errors.IsNotFound(err) {
+		return o.live(ctx, namespace, owner)
+	}
+	return obj, err
+}
+
+func (o *ownerListers) cached(namespace string, owner *meta_v1.OwnerReference) (meta_v1.Object, error) {
+	switch owner.Kind {
+	case "CronJob":
+		return o.cronJobs.CronJobs(namespace).Get(owner.Name)
+	case "DaemonSet":
+		return o.daemonSets.DaemonSets(namespace).Get(owner.Name)
+	case "Deployment":
+		return o.deployments.Deployments(namespace).Get(owner.Name)
+	case "Job":
+		return o.jobs.Jobs(namespace).Get(owner.Name)
+	case "ReplicaSet":
+		return o.replicaSets.ReplicaSets(namespace).Get(owner.Name)
+	case "StatefulSet":
+		return o.statefulSets.StatefulSets(namespace).Get(owner.Name)
+	default:
+		return nil, nil
+	}
+}
+
+func (o *ownerListers) live(ctx context.Context, namespace string, owner *meta_v1.OwnerReference) (meta_v1.Object, error) {
+	opts := meta_v1.GetOptions{}
+	switch owner.Kind {
+	case "CronJob":
+		return o.k8s.BatchV1().CronJobs(namespace).Get(ctx, owner.Name, opts)
+	case "DaemonSet":
+		return o.k8s.AppsV1().DaemonSets(namespace).Get(ctx, owner.Name, opts)
+	case "Deployment":
+		return o.k8s.AppsV1().Deployments(namespace).Get(ctx, owner.Name, opts)
+	case "Job":
+		return o.k8s.BatchV1().Jobs(namespace).Get(ctx, owner.Name, opts)
+	case "ReplicaSet":
+		return o.k8s.AppsV1().ReplicaSets(namespace).Get(ctx, owner.Name, opts)
+	case "StatefulSet":
+		return o.k8s.AppsV1().StatefulSets(namespace).Get(ctx, owner.Name, opts)
+	default:
+		return nil, nil
+	}
+}
+
+// topOwner follows the controllers of the pod (replica-set => deployment, job
+// => cron-job), and returns the last one that the injector can look up
+// together with its kind (nil if there is none).  For the pod template the
+// chain starts with its workload.
+func (s *Server) topOwner(ctx context.Context, pod *core_v1.Pod, workload *meta_v1.ObjectMeta) (meta_v1.Object, string, error) {
+	var (
+		top   meta_v1.Object
+		kind  string
+		owner = meta_v1.GetControllerOfNoCopy(pod)
+	)
+	if workload != nil {
+		top = workload
+		if len(pod.OwnerReferences) > 0 {
+			// the pod template refers to its workload (see workloadTemplate)
+			kind = pod.OwnerReferences[0].Kind
+		}
+		owner = meta_v1.GetControllerOfNoCopy(workload)
+	}
+
+	for depth := 0; owner != nil; depth++ {
+		if depth == maxOwnerDepth {
+			return nil, "", errOwnerChainTooLong
+		}
+		obj, err := s.owners.get(ctx, pod.Namespace, owner)
+		if err != nil {
+			return nil, "", fmt.Errorf("%w: %s '%s': %w",
+				errFailedToLookUpOwner, owner.Kind, owner.Name, err,
+			)
+		}
+		if obj == nil {
+			break // unsupported kind
+		}
+		top, kind = obj, owner.Kind
+		owner = meta_v1.GetControllerOfNoCopy(obj)
+	}
+
+	return top, kind, nil
+}
+
+// ownerKind returns the kind of the owner of the pod for the owner kinds of
+// the rule.  With ResolveDeployments the replica-set is looked up the same way
+// as the owners for the owner selector, and the pod is reported as owned by
+// the deployment if that is the controller of the replica-set.
+func (s *Server) ownerKind(ctx context.Context, kinds *config.InjectOwnerKinds, pod *core_v1.Pod) (string, error) {
+	kind := kinds.OwnerKind(pod)
+	if !kinds.ResolveDeployments || kind != "ReplicaSet" {
+		return kind, nil
+	}
+
+	owner := meta_v1.GetControllerOfNoCopy(pod)
+	if owner == nil || owner.Kind != "ReplicaSet" {
+		return kind, nil
+	}
+	replicaSet, err := s.owners.get(ctx, pod.Namespace, owner)
+	if err != nil {
+		return "", fmt.Errorf("%w: %s '%s': %w",
+			errFailedToLookUpOwner, owner.Kind, owner.Name, err,
+		)
+	}
+	if controller := meta_v1.GetControllerOfNoCopy(replicaSet); controller != nil && controller.Kind == "Deployment" {
+		return controller.Kind, nil
+	}
+	return kind, nil
+}
+
+// matchesOwnerSelector checks the labels and annotations of the owner against
+// the selector (nil owner matches nothing).
+func matchesOwnerSelector(selector *config.InjectOwnerSelector, owner meta_v1.Object) (bool, error) {
+	if owner == nil {
+		return false, nil
+	}
+	matches, err := matchesSelector(&selector.InjectLabelSelector, owner.GetLabels())
+	if err != nil || !matches {
+		return false, err
+	}
+	return selector.MatchesAnnotations(owner.GetAnnotations()), nil
+}
+
+// rolloutOwner identifies the workload of the pod for the rollout as
+// `<kind>/<name>` of its top owner (the pods without one stand for themselves).
+func (s *Server) rolloutOwner(ctx context.Context, pod *core_v1.Pod, workload *meta_v1.ObjectMeta) (string, error) {
+	owner, kind, err := s.topOwner(ctx, pod, workload)
+	if err != nil {
+		return "", err
+	}
+	if owner == nil {
+		name := pod.Name
+		if name == "" {
+			name = pod.GenerateName
+		}
+		return config.OwnerKindPod + "/" + name, nil
+	}
+	return kind + "/" + owner.GetName(), nil
+}
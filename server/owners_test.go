@@ -0,0 +1,74 @@
+package server
+
+import (
+	"context"
+	"testing"
+
+	"github.com/flashbots/kube-sidecar-injector/config"
+	apps_v1 "k8s.io/api/apps/v1"
+	core_v1 "k8s.io/api/core/v1"
+	meta_v1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/client-go/informers"
+	"k8s.io/client-go/kubernetes/fake"
+)
+
+func TestOwnerKindResolvesDeployments(t *testing.T) {
+	controller := true
+	k8s := fake.NewSimpleClientset(
+		&apps_v1.ReplicaSet{ObjectMeta: meta_v1.ObjectMeta{
+			Name:      "app-5d4f8c7b9",
+			Namespace: "default",
+			OwnerReferences: []meta_v1.OwnerReference{{
+				APIVersion: "apps/v1", Kind: "Deployment", Name: "app", Controller: &controller,
+			}},
+		}},
+		&apps_v1.ReplicaSet{ObjectMeta: meta_v1.ObjectMeta{
+			// looks like the one of a deployment, but has no owner
+			Name:      "bare-5d4f8c7b9",
+			Namespace: "default",
+		}},
+	)
+	// the informers are not started => the owners come from k8s api
+	s := &Server{owners: newOwnerListers(informers.NewSharedInformerFactory(k8s, 0), k8s)}
+
+	pod := func(replicaSet string) *core_v1.Pod {
+		return &core_v1.Pod{ObjectMeta: meta_v1.ObjectMeta{
+			Name:      replicaSet + "-x7k2p",
+			Namespace: "default",
+			Labels:    map[string]string{"pod-template-hash": "5d4f8c7b9"},
+			OwnerReferences: []meta_v1.OwnerReference{{
+				APIVersion: "apps/v1", Kind: "ReplicaSet", Name: replicaSet, Controller: &controller,
+			}},
+		}}
+	}
+
+	for _, tc := range []struct {
+		name    string
+		kinds   config.InjectOwnerKinds
+		pod     *core_v1.Pod
+		kind    string
+		failure bool
+	}{
+		{"deployment", config.InjectOwnerKinds{ResolveDeployments: true}, pod("app-5d4f8c7b9"), "Deployment", false},
+		{"bareReplicaSet", config.InjectOwnerKinds{ResolveDeployments: true}, pod("bare-5d4f8c7b9"), "ReplicaSet", false},
+		{"notResolved", config.InjectOwnerKinds{}, pod("app-5d4f8c7b9"), "ReplicaSet", false},
+		{"missingReplicaSet", config.InjectOwnerKinds{ResolveDeployments: true}, pod("gone-5d4f8c7b9"), "", true},
+		{"noOwner", config.InjectOwnerKinds{ResolveDeployments: true}, &core_v1.Pod{}, config.OwnerKindPod, false},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			kind, err := s.ownerKind(context.Background(), &tc.kinds, tc.pod)
+			if tc.failure {
+				if err == nil {
+					t.Fatalf("expected the failure, got kind %s", kind)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("unexpected error: %v", err)
+			}
+			if kind != tc.kind {
+				t.Errorf("unexpected owner kind: got %s, want %s", kind, tc.kind)
+			}
+		})
+	}
+}
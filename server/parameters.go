@@ -0,0 +1,52 @@
+package server
+
+import (
+	"context"
+
+	"github.com/flashbots/kube-sidecar-injector/config"
+	"github.com/flashbots/kube-sidecar-injector/logutils"
+	"go.uber.org/zap"
+	core_v1 "k8s.io/api/core/v1"
+)
+
+// resolveParameters returns the values of inject rule parameters taking into
+// account the overrides from pod's annotations.  Invalid overrides are ignored.
+func resolveParameters(
+	ctx context.Context,
+	inject *config.Inject,
+	pod *core_v1.Pod,
+) map[string]string {
+	if len(inject.Parameters) == 0 {
+		return nil
+	}
+
+	l := logutils.LoggerFromContext(ctx)
+
+	res := make(map[string]string, len(inject.Parameters))
+	for _, p := range inject.Parameters {
+		res[p.Name] = p.Default
+
+		annotation := p.Annotation(inject)
+		value, overridden := pod.Annotations[annotation]
+		if !overridden {
+			continue
+		}
+
+		if err := p.Check(value); err != nil {
+			l.Warn("Invalid parameter override => using default...",
+				zap.String("annotation", annotation),
+				zap.String("default", p.Default),
+				zap.Error(err),
+			)
+			continue
+		}
+
+		l.Info("Using parameter override",
+			zap.String("annotation", annotation),
+			zap.String("value", value),
+		)
+		res[p.Name] = value
+	}
+
+	return res
+}
@@ -0,0 +1,57 @@
+package server
+
+import (
+	"errors"
+
+	"github.com/flashbots/kube-sidecar-injector/config"
+	core_v1 "k8s.io/api/core/v1"
+	meta_v1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/labels"
+)
+
+var (
+	errNamespacesNotWatched = errors.New("namespaces are not watched")
+)
+
+// matchesSelectors checks the label and namespace selectors of the rule
+// in-process (for the cases when the webhook can not do that for us).  The
+// namespace lister is only there when some rule needs it (see New).
+func (s *Server) matchesSelectors(inject *config.Inject, pod *core_v1.Pod) (bool, error) {
+	matches, err := matchesSelector(inject.LabelSelector, pod.Labels)
+	if err != nil || !matches {
+		return false, err
+	}
+
+	if inject.NamespaceSelector != nil {
+		if s.namespaces == nil {
+			return false, errNamespacesNotWatched
+		}
+		namespace, err := s.namespaces.Get(pod.Namespace)
+		if err != nil {
+			return false, err
+		}
+		matches, err := matchesSelector(inject.NamespaceSelector, namespace.Labels)
+		if err != nil || !matches {
+			return false, err
+		}
+	}
+
+	return true, nil
+}
+
+// matchesSelector returns true if the labels match the selector (nil selector
+// matches everything).
+func matchesSelector(selector *config.InjectLabelSelector, _labels map[string]string) (bool, error) {
+	if selector == nil {
+		return true, nil
+	}
+	ls, err := selector.LabelSelector()
+	if err != nil {
+		return false, err
+	}
+	_selector, err := meta_v1.LabelSelectorAsSelector(ls)
+	if err != nil {
+		return false, err
+	}
+	return _selector.Matches(labels.Set(_labels)), nil
+}
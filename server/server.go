@@ -8,6 +8,7 @@ import (
 	"net/http"
 	"os"
 	"os/signal"
+	"sync/atomic"
 	"syscall"
 	"time"
 
@@ -16,18 +17,35 @@ import (
 	"github.com/flashbots/kube-sidecar-injector/global"
 	"github.com/flashbots/kube-sidecar-injector/httplogger"
 	"github.com/flashbots/kube-sidecar-injector/logutils"
+	"github.com/prometheus/client_golang/prometheus/promhttp"
 	"go.uber.org/zap"
+	k8s_version "k8s.io/apimachinery/pkg/util/version"
+	"k8s.io/client-go/informers"
 	"k8s.io/client-go/kubernetes"
+	core_v1_listers "k8s.io/client-go/listers/core/v1"
 	k8s_config "k8s.io/client-go/rest"
 )
 
+var (
+	errFailedToSyncInformer = errors.New("failed to sync informer")
+)
+
 type Server struct {
 	cfg *config.Config
 	k8s *kubernetes.Clientset
 	log *zap.Logger
 	tls *cert.Bundle
 
-	inject map[string]*config.Inject
+	k8sVersion *k8s_version.Version // nil if unknown
+
+	informers  informers.SharedInformerFactory
+	namespaces core_v1_listers.NamespaceLister // nil if no rule needs it
+	owners     *ownerListers                   // nil if no rule needs them
+
+	ready atomic.Bool // set once the informers are synced
+
+	inject   map[string]*config.Inject
+	onDemand map[string]string // name => fingerprint
 }
 
 func New(cfg *config.Config) (*Server, error) {
@@ -46,6 +64,20 @@ func New(cfg *config.Config) (*Server, error) {
 		return nil, err
 	}
 
+	var k8sVersion *k8s_version.Version
+	if info, err := k8s.Discovery().ServerVersion(); err == nil {
+		if k8sVersion, err = k8s_version.ParseGeneric(info.GitVersion); err != nil {
+			l.Warn("Failed to parse k8s version",
+				zap.String("version", info.GitVersion),
+				zap.Error(err),
+			)
+		}
+	} else {
+		l.Warn("Failed to detect k8s version",
+			zap.Error(err),
+		)
+	}
+
 	// tls
 
 	// TODO: implement renewal
@@ -68,11 +100,30 @@ func New(cfg *config.Config) (*Server, error) {
 		cfg: cfg,
 		k8s: k8s,
 		log: l,
+
+		k8sVersion: k8sVersion,
 	}
 
+	srv.informers = informers.NewSharedInformerFactory(k8s, 0)
+
 	srv.inject = make(map[string]*config.Inject, len(cfg.Inject))
+	srv.onDemand = make(map[string]string)
 	for _, i := range cfg.Inject {
 		srv.inject[i.Fingerprint()] = i
+		if i.OnDemand {
+			srv.onDemand[i.Name] = i.Fingerprint()
+		}
+		namespaceAnnotations := i.Name != "" && !cfg.K8S.DisableNamespaceAnnotations
+		if (namespaceAnnotations || i.OnDemand && i.NamespaceSelector != nil) && srv.namespaces == nil {
+			// namespace annotations of named rules, and namespace selectors
+			// of on-demand rules are resolved in-process
+			srv.namespaces = srv.informers.Core().V1().Namespaces().Lister()
+		}
+		resolveDeployments := i.OwnerKinds != nil && i.OwnerKinds.ResolveDeployments
+		if (i.OwnerSelector != nil || i.Rollout != nil || resolveDeployments) && srv.owners == nil {
+			// the informers are only started for the listers in use
+			srv.owners = newOwnerListers(srv.informers, k8s)
+		}
 	}
 
 	return srv, nil
@@ -84,6 +135,7 @@ func (s *Server) Run() error {
 
 	mux := http.NewServeMux()
 	mux.HandleFunc(s.cfg.Server.PathHealthcheck, s.handleHealthcheck)
+	mux.Handle(s.cfg.Server.PathMetrics, promhttp.Handler())
 	mux.HandleFunc(s.cfg.Server.PathWebhook+"/", s.handleWebhook)
 	handler := httplogger.Middleware(l, mux)
 
@@ -137,12 +189,21 @@ func (s *Server) Run() error {
 		done <- struct{}{}
 	}()
 
-	// register webhook
+	// sync informers, then register webhook
+
+	stop := make(chan struct{})
+	defer close(stop)
+	s.informers.Start(stop)
 
 	ctx, cancel := context.WithTimeout(ctx, 30*time.Second)
 	defer cancel()
-	if err := s.upsertMutatingWebhookConfiguration(ctx); err != nil {
+	if err := s.syncInformers(ctx); err != nil {
 		fail <- err
+	} else {
+		s.ready.Store(true)
+		if err := s.upsertMutatingWebhookConfiguration(ctx); err != nil {
+			fail <- err
+		}
 	}
 
 	// wait
@@ -151,3 +212,12 @@ func (s *Server) Run() error {
 
 	return nil
 }
+
+func (s *Server) syncInformers(ctx context.Context) error {
+	for informer, synced := range s.informers.WaitForCacheSync(ctx.Done()) {
+		if !synced {
+			return fmt.Errorf("%w: %v", errFailedToSyncInformer, informer)
+		}
+	}
+	return nil
+}
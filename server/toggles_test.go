@@ -0,0 +1,61 @@
+package server
+
+import (
+	"context"
+	"errors"
+	"testing"
+
+	"github.com/flashbots/kube-sidecar-injector/config"
+	"github.com/flashbots/kube-sidecar-injector/patch"
+	admission_v1 "k8s.io/api/admission/v1"
+	core_v1 "k8s.io/api/core/v1"
+)
+
+func TestMutatePodHostPIDExplicitFalse(t *testing.T) {
+	inject := &config.Inject{
+		MaxIterations: config.DefaultMaxIterations,
+		HostPID: &config.InjectPodToggle{
+			Value:      true,
+			OnConflict: config.ConflictPolicyFail,
+		},
+	}
+	fingerprint := inject.Fingerprint()
+	s := &Server{
+		cfg:    &config.Config{K8S: config.K8S{ServiceName: "test"}},
+		inject: map[string]*config.Inject{fingerprint: inject},
+	}
+
+	for _, tc := range []struct {
+		name    string
+		raw     string
+		failure bool
+	}{
+		{"unset", `{"containers": [{"name": "main", "image": "busybox"}]}`, false},
+		{"explicitFalse", `{"hostPID": false, "containers": [{"name": "main", "image": "busybox"}]}`, true},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			raw := []byte(`{"metadata": {"name": "pod", "namespace": "default"}, "spec": ` + tc.raw + `}`)
+			spec, err := rawPodSpec(raw, "")
+			if err != nil {
+				t.Fatalf("unexpected error: %v", err)
+			}
+			pod := &core_v1.Pod{}
+			pod.Name, pod.Namespace = "pod", "default"
+			pod.Spec.Containers = []core_v1.Container{{Name: "main", Image: "busybox"}}
+
+			p, err := s.mutatePod(context.Background(), pod, spec, fingerprint, nil, admission_v1.Create)
+			if tc.failure {
+				if !errors.Is(err, patch.ErrConflict) {
+					t.Fatalf("expected the conflict, got %v", err)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("unexpected error: %v", err)
+			}
+			if len(p) == 0 {
+				t.Errorf("expected hostPID to be injected")
+			}
+		})
+	}
+}
@@ -0,0 +1,90 @@
+package server
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"regexp"
+
+	json_patch "github.com/evanphx/json-patch"
+	"github.com/flashbots/kube-sidecar-injector/validation"
+	admission_v1 "k8s.io/api/admission/v1"
+	core_v1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/util/validation/field"
+)
+
+var (
+	errPatchProducesInvalidPod = errors.New("patch produces invalid pod")
+)
+
+var (
+	regexpFieldIndex = regexp.MustCompile(`\[[0-9]+\]`)
+)
+
+// applyPatch applies the patch to the raw pod, and decodes the result.
+func applyPatch(raw []byte, p json_patch.Patch) ([]byte, *core_v1.Pod, error) {
+	b, err := p.Apply(raw)
+	if err != nil {
+		return nil, nil, fmt.Errorf("%w: %w", errPatchProducesInvalidPod, err)
+	}
+	pod := &core_v1.Pod{}
+	if err := json.Unmarshal(b, pod); err != nil {
+		return nil, nil, fmt.Errorf("%w: %w", errPatchProducesInvalidPod, err)
+	}
+	return b, pod, nil
+}
+
+// validatePatch applies the patch to the object of the admission request, and
+// checks that it does not introduce the errors that would make k8s reject the
+// pod (the errors that the pod already had are ignored).  With `template` set,
+// the object is the workload, and the pod is its pod template.
+func validatePatch(
+	req *admission_v1.AdmissionRequest,
+	template string,
+	pod *core_v1.Pod,
+	p json_patch.Patch,
+) error {
+	var patched *core_v1.Pod
+	if template == "" {
+		_, _patched, err := applyPatch(req.Object.Raw, p)
+		if err != nil {
+			return err
+		}
+		patched = _patched
+	} else {
+		b, err := p.Apply(req.Object.Raw)
+		if err != nil {
+			return fmt.Errorf("%w: %w", errPatchProducesInvalidPod, err)
+		}
+		_req := *req
+		_req.Object.Raw = b
+		if patched, _, _, err = workloadTemplate(&_req); err != nil {
+			return fmt.Errorf("%w: %w", errPatchProducesInvalidPod, err)
+		}
+	}
+
+	// the indices in the field paths are not compared as the injected elements
+	// could shift the ones of the existing elements
+	key := func(err *field.Error) string {
+		return fmt.Sprintf("%s:%s:%v:%s",
+			regexpFieldIndex.ReplaceAllString(err.Field, "[*]"), err.Type, err.BadValue, err.Detail,
+		)
+	}
+
+	before := make(map[string]struct{})
+	for _, err := range validation.Pod(pod) {
+		before[key(err)] = struct{}{}
+	}
+
+	errs := field.ErrorList{}
+	for _, err := range validation.Pod(patched) {
+		if _, existed := before[key(err)]; !existed {
+			errs = append(errs, err)
+		}
+	}
+	if len(errs) > 0 {
+		return fmt.Errorf("%w: %w", errPatchProducesInvalidPod, errs.ToAggregate())
+	}
+
+	return nil
+}
@@ -0,0 +1,135 @@
+package server
+
+import (
+	"encoding/json"
+	"errors"
+	"testing"
+
+	json_patch "github.com/evanphx/json-patch"
+	"github.com/flashbots/kube-sidecar-injector/operation"
+	admission_v1 "k8s.io/api/admission/v1"
+	core_v1 "k8s.io/api/core/v1"
+	meta_v1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime"
+)
+
+func TestValidatePatch(t *testing.T) {
+	pod := &core_v1.Pod{
+		TypeMeta:   meta_v1.TypeMeta{APIVersion: "v1", Kind: "Pod"},
+		ObjectMeta: meta_v1.ObjectMeta{Name: "pod", Namespace: "default"},
+		Spec: core_v1.PodSpec{
+			Containers: []core_v1.Container{{Name: "main", Image: "busybox"}},
+			Volumes: []core_v1.Volume{{
+				Name:         "cache",
+				VolumeSource: core_v1.VolumeSource{EmptyDir: &core_v1.EmptyDirVolumeSource{}},
+			}},
+		},
+	}
+	raw, err := json.Marshal(pod)
+	if err != nil {
+		t.Fatal(err)
+	}
+	req := &admission_v1.AdmissionRequest{
+		Kind:   meta_v1.GroupVersionKind{Version: "v1", Kind: "Pod"},
+		Object: runtime.RawExtension{Raw: raw},
+	}
+
+	op := func(op func(string, interface{}) (json_patch.Operation, error), path string, value interface{}) json_patch.Operation {
+		res, err := op(path, value)
+		if err != nil {
+			t.Fatal(err)
+		}
+		return res
+	}
+
+	for _, tc := range []struct {
+		name  string
+		patch json_patch.Patch
+		valid bool
+	}{
+		{
+			name: "valid container",
+			patch: json_patch.Patch{
+				op(operation.Add, "/spec/containers/-", core_v1.Container{Name: "sidecar", Image: "sidecar"}),
+			},
+			valid: true,
+		},
+		{
+			name: "invalid container name",
+			patch: json_patch.Patch{
+				op(operation.Add, "/spec/containers/-", core_v1.Container{Name: "Sidecar_1", Image: "sidecar"}),
+			},
+		},
+		{
+			name: "duplicate container",
+			patch: json_patch.Patch{
+				op(operation.Add, "/spec/containers/-", core_v1.Container{Name: "main", Image: "sidecar"}),
+			},
+		},
+		{
+			name: "volume with multiple sources",
+			patch: json_patch.Patch{
+				op(operation.Add, "/spec/volumes/0/configMap", core_v1.ConfigMapVolumeSource{
+					LocalObjectReference: core_v1.LocalObjectReference{Name: "cm"},
+				}),
+			},
+		},
+		{
+			name: "mount of missing volume",
+			patch: json_patch.Patch{
+				op(operation.Add, "/spec/containers/0/volumeMounts", []core_v1.VolumeMount{{Name: "missing", MountPath: "/data"}}),
+			},
+		},
+		{
+			name: "host pid with shared process namespace",
+			patch: json_patch.Patch{
+				op(operation.Add, "/spec/hostPID", true),
+				op(operation.Add, "/spec/shareProcessNamespace", true),
+			},
+		},
+		{
+			name: "invalid label",
+			patch: json_patch.Patch{
+				op(operation.Add, "/metadata/labels", map[string]string{"label": "not valid"}),
+			},
+		},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			err := validatePatch(req, "", pod, tc.patch)
+			switch {
+			case tc.valid && err != nil:
+				t.Errorf("unexpected error: %v", err)
+			case !tc.valid && !errors.Is(err, errPatchProducesInvalidPod):
+				t.Errorf("expected the patch to be rejected, got: %v", err)
+			}
+		})
+	}
+}
+
+func TestValidatePatchIgnoresExistingErrors(t *testing.T) {
+	pod := &core_v1.Pod{
+		ObjectMeta: meta_v1.ObjectMeta{Name: "pod"},
+		Spec: core_v1.PodSpec{
+			Containers: []core_v1.Container{{Name: "main", Image: "busybox", Ports: []core_v1.ContainerPort{
+				{Name: "this-name-is-too-long", ContainerPort: 8080},
+			}}},
+		},
+	}
+	raw, err := json.Marshal(pod)
+	if err != nil {
+		t.Fatal(err)
+	}
+	req := &admission_v1.AdmissionRequest{
+		Kind:   meta_v1.GroupVersionKind{Version: "v1", Kind: "Pod"},
+		Object: runtime.RawExtension{Raw: raw},
+	}
+
+	// the injected container shifts the existing one to the next index
+	op, err := operation.Add("/spec/containers/0", core_v1.Container{Name: "sidecar", Image: "sidecar"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := validatePatch(req, "", pod, json_patch.Patch{op}); err != nil {
+		t.Errorf("unexpected error: %v", err)
+	}
+}
@@ -0,0 +1,160 @@
+package server
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"strings"
+
+	json_patch "github.com/evanphx/json-patch"
+	"github.com/flashbots/kube-sidecar-injector/operation"
+	"github.com/flashbots/kube-sidecar-injector/patch"
+	admission_v1 "k8s.io/api/admission/v1"
+	apps_v1 "k8s.io/api/apps/v1"
+	batch_v1 "k8s.io/api/batch/v1"
+	core_v1 "k8s.io/api/core/v1"
+	meta_v1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+)
+
+var (
+	errJobTemplateImmutable = errors.New("job template is immutable")
+	errUnsupportedWorkload  = errors.New("unsupported workload")
+	errWorkloadOfCronJob    = errors.New("job is created by cron-job")
+)
+
+// workloadTemplate decodes the workload of the admission request, and returns
+// its pod template in the form of a pod, together with the metadata of the
+// workload and the json pointer to the template within the workload.
+func workloadTemplate(req *admission_v1.AdmissionRequest) (*core_v1.Pod, *meta_v1.ObjectMeta, string, error) {
+	var (
+		meta     *meta_v1.ObjectMeta
+		template *core_v1.PodTemplateSpec
+		pointer  = "/spec/template"
+	)
+
+	switch req.Kind.Group + "/" + req.Kind.Kind {
+	case "apps/DaemonSet":
+		workload := &apps_v1.DaemonSet{}
+		if err := json.Unmarshal(req.Object.Raw, workload); err != nil {
+			return nil, nil, "", err
+		}
+		meta, template = &workload.ObjectMeta, &workload.Spec.Template
+
+	case "apps/Deployment":
+		workload := &apps_v1.Deployment{}
+		if err := json.Unmarshal(req.Object.Raw, workload); err != nil {
+			return nil, nil, "", err
+		}
+		meta, template = &workload.ObjectMeta, &workload.Spec.Template
+
+	case "apps/StatefulSet":
+		workload := &apps_v1.StatefulSet{}
+		if err := json.Unmarshal(req.Object.Raw, workload); err != nil {
+			return nil, nil, "", err
+		}
+		meta, template = &workload.ObjectMeta, &workload.Spec.Template
+
+	case "batch/CronJob":
+		workload := &batch_v1.CronJob{}
+		if err := json.Unmarshal(req.Object.Raw, workload); err != nil {
+			return nil, nil, "", err
+		}
+		meta, template = &workload.ObjectMeta, &workload.Spec.JobTemplate.Spec.Template
+		pointer = "/spec/jobTemplate/spec/template"
+
+	case "batch/Job":
+		if req.Operation == admission_v1.Update {
+			// k8s api-server rejects any change of the template of the job
+			return nil, nil, "", errJobTemplateImmutable
+		}
+		workload := &batch_v1.Job{}
+		if err := json.Unmarshal(req.Object.Raw, workload); err != nil {
+			return nil, nil, "", err
+		}
+		for _, owner := range workload.OwnerReferences {
+			if owner.Kind == "CronJob" {
+				// its template was mutated along with the cron-job
+				return nil, nil, "", errWorkloadOfCronJob
+			}
+		}
+		meta, template = &workload.ObjectMeta, &workload.Spec.Template
+
+	default:
+		return nil, nil, "", fmt.Errorf("%w: %s/%s",
+			errUnsupportedWorkload, req.Kind.Group, req.Kind.Kind,
+		)
+	}
+
+	namespace := meta.Namespace
+	if namespace == "" {
+		namespace = req.Namespace
+	}
+
+	pod := &core_v1.Pod{
+		ObjectMeta: *template.ObjectMeta.DeepCopy(),
+		Spec:       *template.Spec.DeepCopy(),
+	}
+	pod.Name = ""
+	pod.GenerateName = meta.Name + "-"
+	pod.Namespace = namespace
+	pod.OwnerReferences = []meta_v1.OwnerReference{{
+		APIVersion: req.Kind.Group + "/" + req.Kind.Version,
+		Kind:       req.Kind.Kind,
+		Name:       meta.Name,
+		UID:        meta.UID,
+	}}
+
+	return pod, meta, pointer, nil
+}
+
+// templatePatch moves the patch generated for the pod template under its json
+// pointer within the raw workload.  The templates may come without metadata,
+// and then the patch creates it first (json patch can not add the labels or
+// annotations into the object that does not exist).
+func templatePatch(raw []byte, pointer string, p json_patch.Patch) (json_patch.Patch, error) {
+	prefixed, err := patch.Prefix(p, pointer)
+	if err != nil {
+		return nil, err
+	}
+
+	var workload interface{}
+	if err := json.Unmarshal(raw, &workload); err != nil {
+		return nil, err
+	}
+	if metadata := lookUpPointer(workload, pointer+"/metadata"); metadata != nil {
+		return prefixed, nil
+	}
+
+	op, err := operation.Add(pointer+"/metadata", map[string]interface{}{})
+	if err != nil {
+		return nil, err
+	}
+	return append(json_patch.Patch{op}, prefixed...), nil
+}
+
+// rawPodSpec returns the pod spec (of the pod, or of the pod template at the
+// json pointer within the workload) decoded as is.  Unlike the typed one, it
+// tells the plain fields that are explicitly set to their zero values from
+// the ones that are not set at all.
+func rawPodSpec(raw []byte, pointer string) (map[string]interface{}, error) {
+	var doc interface{}
+	if err := json.Unmarshal(raw, &doc); err != nil {
+		return nil, err
+	}
+	spec, _ := lookUpPointer(doc, pointer+"/spec").(map[string]interface{})
+	return spec, nil
+}
+
+// lookUpPointer returns the value at the json pointer within the decoded json
+// document (nil if there is none).  Only the objects are traversed, as the
+// pointers to the pod templates do not go through the arrays.
+func lookUpPointer(doc interface{}, pointer string) interface{} {
+	for _, key := range strings.Split(strings.TrimPrefix(pointer, "/"), "/") {
+		obj, ok := doc.(map[string]interface{})
+		if !ok {
+			return nil
+		}
+		doc = obj[key]
+	}
+	return doc
+}
@@ -0,0 +1,104 @@
+package server
+
+import (
+	"testing"
+
+	json_patch "github.com/evanphx/json-patch"
+	"github.com/flashbots/kube-sidecar-injector/config"
+	"github.com/flashbots/kube-sidecar-injector/operation"
+	"github.com/flashbots/kube-sidecar-injector/patch"
+	admission_v1 "k8s.io/api/admission/v1"
+	meta_v1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime"
+)
+
+func TestTemplatePatchWithoutMetadata(t *testing.T) {
+	req := &admission_v1.AdmissionRequest{
+		Kind:      meta_v1.GroupVersionKind{Group: "batch", Version: "v1", Kind: "Job"},
+		Namespace: "default",
+		Operation: admission_v1.Create,
+		Object: runtime.RawExtension{Raw: []byte(`{
+			"apiVersion": "batch/v1",
+			"kind": "Job",
+			"metadata": {"name": "job", "namespace": "default"},
+			"spec": {
+				"template": {
+					"spec": {
+						"restartPolicy": "Never",
+						"containers": [{"name": "main", "image": "busybox"}]
+					}
+				}
+			}
+		}`)},
+	}
+
+	pod, _, pointer, err := workloadTemplate(req)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	labels, _, err := patch.InsertPodLabels(pod, map[string]string{"injected": "true"}, config.ConflictPolicySkip)
+	if err != nil {
+		t.Fatal(err)
+	}
+	annotations, err := patch.UpsertPodAnnotations(pod, map[string]string{"injected": "true"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	p := append(labels, annotations...)
+
+	if prefixed, err := patch.Prefix(p, pointer); err != nil {
+		t.Fatal(err)
+	} else if _, err := prefixed.Apply(req.Object.Raw); err == nil {
+		t.Fatalf("expected the plain prefixed patch to fail on the template without metadata")
+	}
+
+	p, err = templatePatch(req.Object.Raw, pointer, p)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := validatePatch(req, pointer, pod, p); err != nil {
+		t.Fatalf("unexpected validation error: %v", err)
+	}
+
+	b, err := p.Apply(req.Object.Raw)
+	if err != nil {
+		t.Fatal(err)
+	}
+	patched, _, _, err := workloadTemplate(&admission_v1.AdmissionRequest{
+		Kind:      req.Kind,
+		Namespace: req.Namespace,
+		Operation: req.Operation,
+		Object:    runtime.RawExtension{Raw: b},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if patched.Labels["injected"] != "true" || patched.Annotations["injected"] != "true" {
+		t.Errorf("labels or annotations were not injected into the template: %s", b)
+	}
+}
+
+func TestTemplatePatchWithMetadata(t *testing.T) {
+	raw := []byte(`{"spec": {"template": {"metadata": {"labels": {"app": "job"}}, "spec": {}}}}`)
+
+	op, err := operation.Add("/metadata/labels/injected", "true")
+	if err != nil {
+		t.Fatal(err)
+	}
+	p, err := templatePatch(raw, "/spec/template", json_patch.Patch{op})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(p) != 1 {
+		t.Fatalf("unexpected operations in the patch (existing metadata must be kept): %d", len(p))
+	}
+
+	b, err := p.Apply(raw)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if expected := `{"spec":{"template":{"metadata":{"labels":{"app":"job","injected":"true"}},"spec":{}}}}`; string(b) != expected {
+		t.Errorf("unexpected patched workload:\ngot:  %s\nwant: %s", b, expected)
+	}
+}
@@ -0,0 +1,432 @@
+package validation
+
+import (
+	"encoding/json"
+	"fmt"
+
+	core_v1 "k8s.io/api/core/v1"
+	k8s_api_validation "k8s.io/apimachinery/pkg/api/validation"
+	k8s_meta_validation "k8s.io/apimachinery/pkg/apis/meta/v1/validation"
+	"k8s.io/apimachinery/pkg/util/intstr"
+	k8s_validation "k8s.io/apimachinery/pkg/util/validation"
+	"k8s.io/apimachinery/pkg/util/validation/field"
+)
+
+// Pod checks the pod against the subset of the rules that k8s api-server
+// applies to the pods (the ones that the injected elements could violate).
+func Pod(pod *core_v1.Pod) field.ErrorList {
+	errs := field.ErrorList{}
+
+	metadata := field.NewPath("metadata")
+	errs = append(errs, k8s_meta_validation.ValidateLabels(pod.Labels, metadata.Child("labels"))...)
+	errs = append(errs, k8s_api_validation.ValidateAnnotations(pod.Annotations, metadata.Child("annotations"))...)
+
+	spec := field.NewPath("spec")
+	volumes, volumeErrs := validateVolumes(pod.Spec.Volumes, spec.Child("volumes"))
+	errs = append(errs, volumeErrs...)
+
+	names := make(map[string]struct{}, len(pod.Spec.InitContainers)+len(pod.Spec.Containers)+len(pod.Spec.EphemeralContainers))
+	for idx, c := range pod.Spec.InitContainers {
+		errs = append(errs, validateContainer(&c, names, volumes, spec.Child("initContainers").Index(idx))...)
+	}
+	for idx, c := range pod.Spec.Containers {
+		errs = append(errs, validateContainer(&c, names, volumes, spec.Child("containers").Index(idx))...)
+	}
+	for idx, ec := range pod.Spec.EphemeralContainers {
+		c := core_v1.Container(ec.EphemeralContainerCommon)
+		errs = append(errs, validateContainer(&c, names, volumes, spec.Child("ephemeralContainers").Index(idx))...)
+	}
+
+	for idx, t := range pod.Spec.Tolerations {
+		errs = append(errs, validateToleration(&t, spec.Child("tolerations").Index(idx))...)
+	}
+
+	errs = append(errs, validatePodSpec(&pod.Spec, spec)...)
+
+	return errs
+}
+
+// validatePodSpec checks the rules that span across the fields of the pod
+// spec.
+func validatePodSpec(spec *core_v1.PodSpec, path *field.Path) field.ErrorList {
+	errs := field.ErrorList{}
+
+	{ // shareProcessNamespace
+		if spec.ShareProcessNamespace != nil && *spec.ShareProcessNamespace && spec.HostPID {
+			errs = append(errs, field.Invalid(path.Child("securityContext", "shareProcessNamespace"), true,
+				"ShareProcessNamespace and HostPID cannot both be enabled",
+			))
+		}
+	}
+
+	{ // restartPolicy of the containers
+		for idx, c := range spec.InitContainers {
+			if c.RestartPolicy != nil && *c.RestartPolicy != core_v1.ContainerRestartPolicyAlways {
+				errs = append(errs, field.NotSupported(path.Child("initContainers").Index(idx).Child("restartPolicy"), *c.RestartPolicy,
+					[]core_v1.ContainerRestartPolicy{core_v1.ContainerRestartPolicyAlways},
+				))
+			}
+		}
+		for idx, c := range spec.Containers {
+			if c.RestartPolicy != nil {
+				errs = append(errs, field.Forbidden(path.Child("containers").Index(idx).Child("restartPolicy"),
+					"may not be set for non-init containers",
+				))
+			}
+		}
+	}
+
+	{ // host ports
+		type hostPort struct {
+			ip       string
+			port     int32
+			protocol core_v1.Protocol
+		}
+		hostPorts := make(map[hostPort]struct{})
+		for _, containers := range []struct {
+			name       string
+			containers []core_v1.Container
+		}{
+			{"initContainers", spec.InitContainers},
+			{"containers", spec.Containers},
+		} {
+			for idx, c := range containers.containers {
+				for pidx, p := range c.Ports {
+					port := path.Child(containers.name).Index(idx).Child("ports").Index(pidx)
+					if spec.HostNetwork && p.HostPort != 0 && p.HostPort != p.ContainerPort {
+						errs = append(errs, field.Invalid(port.Child("containerPort"), p.ContainerPort,
+							"must match `hostPort` when `hostNetwork` is true",
+						))
+					}
+					if p.HostPort == 0 {
+						continue
+					}
+					protocol := p.Protocol
+					if protocol == "" {
+						protocol = core_v1.ProtocolTCP
+					}
+					key := hostPort{ip: p.HostIP, port: p.HostPort, protocol: protocol}
+					if _, duplicate := hostPorts[key]; duplicate {
+						errs = append(errs, field.Duplicate(port.Child("hostPort"),
+							fmt.Sprintf("%s/%d", protocol, p.HostPort),
+						))
+					}
+					hostPorts[key] = struct{}{}
+				}
+			}
+		}
+	}
+
+	return errs
+}
+
+func validateVolumes(
+	volumes []core_v1.Volume,
+	path *field.Path,
+) (map[string]struct{}, field.ErrorList) {
+	errs := field.ErrorList{}
+
+	names := make(map[string]struct{}, len(volumes))
+	for idx, v := range volumes {
+		name := path.Index(idx).Child("name")
+		switch {
+		case v.Name == "":
+			errs = append(errs, field.Required(name, ""))
+		default:
+			for _, msg := range k8s_validation.IsDNS1123Label(v.Name) {
+				errs = append(errs, field.Invalid(name, v.Name, msg))
+			}
+			if _, duplicate := names[v.Name]; duplicate {
+				errs = append(errs, field.Duplicate(name, v.Name))
+			}
+		}
+		names[v.Name] = struct{}{}
+
+		switch sources := volumeSources(&v.VolumeSource); {
+		case sources == 0:
+			errs = append(errs, field.Required(path.Index(idx), "must specify a volume type"))
+		case sources > 1:
+			errs = append(errs, field.Forbidden(path.Index(idx), "may not specify more than 1 volume type"))
+		}
+	}
+
+	return names, errs
+}
+
+// volumeSources counts the sources that are set in the volume.
+func volumeSources(vs *core_v1.VolumeSource) int {
+	b, err := json.Marshal(vs)
+	if err != nil {
+		// k8s api types are always serialisable
+		panic(err)
+	}
+	var sources map[string]json.RawMessage
+	if err := json.Unmarshal(b, &sources); err != nil {
+		panic(err)
+	}
+	return len(sources)
+}
+
+func validateContainer(
+	c *core_v1.Container,
+	names map[string]struct{},
+	volumes map[string]struct{},
+	path *field.Path,
+) field.ErrorList {
+	errs := field.ErrorList{}
+
+	{ // name
+		name := path.Child("name")
+		switch {
+		case c.Name == "":
+			errs = append(errs, field.Required(name, ""))
+		default:
+			for _, msg := range k8s_validation.IsDNS1123Label(c.Name) {
+				errs = append(errs, field.Invalid(name, c.Name, msg))
+			}
+			if _, duplicate := names[c.Name]; duplicate {
+				errs = append(errs, field.Duplicate(name, c.Name))
+			}
+		}
+		names[c.Name] = struct{}{}
+	}
+
+	{ // image
+		if c.Image == "" {
+			errs = append(errs, field.Required(path.Child("image"), ""))
+		}
+	}
+
+	{ // ports
+		portNames := make(map[string]struct{}, len(c.Ports))
+		for idx, p := range c.Ports {
+			port := path.Child("ports").Index(idx)
+			if p.Name != "" {
+				for _, msg := range k8s_validation.IsValidPortName(p.Name) {
+					errs = append(errs, field.Invalid(port.Child("name"), p.Name, msg))
+				}
+				if _, duplicate := portNames[p.Name]; duplicate {
+					errs = append(errs, field.Duplicate(port.Child("name"), p.Name))
+				}
+				portNames[p.Name] = struct{}{}
+			}
+			for _, msg := range k8s_validation.IsValidPortNum(int(p.ContainerPort)) {
+				errs = append(errs, field.Invalid(port.Child("containerPort"), p.ContainerPort, msg))
+			}
+			if p.HostPort != 0 {
+				for _, msg := range k8s_validation.IsValidPortNum(int(p.HostPort)) {
+					errs = append(errs, field.Invalid(port.Child("hostPort"), p.HostPort, msg))
+				}
+			}
+			switch p.Protocol {
+			case "", core_v1.ProtocolTCP, core_v1.ProtocolUDP, core_v1.ProtocolSCTP:
+			default:
+				errs = append(errs, field.NotSupported(port.Child("protocol"), p.Protocol,
+					[]core_v1.Protocol{core_v1.ProtocolTCP, core_v1.ProtocolUDP, core_v1.ProtocolSCTP},
+				))
+			}
+		}
+	}
+
+	{ // env
+		for idx, ev := range c.Env {
+			name := path.Child("env").Index(idx).Child("name")
+			if ev.Name == "" {
+				errs = append(errs, field.Required(name, ""))
+				continue
+			}
+			for _, msg := range k8s_validation.IsEnvVarName(ev.Name) {
+				errs = append(errs, field.Invalid(name, ev.Name, msg))
+			}
+		}
+	}
+
+	{ // resources
+		resources := path.Child("resources")
+		for name, q := range c.Resources.Requests {
+			if q.Sign() < 0 {
+				errs = append(errs, field.Invalid(resources.Child("requests").Key(string(name)), q.String(), "must be greater than or equal to 0"))
+			}
+		}
+		for name, q := range c.Resources.Limits {
+			if q.Sign() < 0 {
+				errs = append(errs, field.Invalid(resources.Child("limits").Key(string(name)), q.String(), "must be greater than or equal to 0"))
+			}
+			if r, exists := c.Resources.Requests[name]; exists && r.Cmp(q) > 0 {
+				errs = append(errs, field.Invalid(resources.Child("requests").Key(string(name)), r.String(),
+					fmt.Sprintf("must be less than or equal to %s limit of %s", name, q.String()),
+				))
+			}
+		}
+	}
+
+	{ // probes
+		errs = append(errs, validateProbe(c.LivenessProbe, path.Child("livenessProbe"))...)
+		errs = append(errs, validateProbe(c.ReadinessProbe, path.Child("readinessProbe"))...)
+		errs = append(errs, validateProbe(c.StartupProbe, path.Child("startupProbe"))...)
+	}
+
+	{ // securityContext
+		errs = append(errs, validateSecurityContext(c.SecurityContext, path.Child("securityContext"))...)
+	}
+
+	{ // volumeMounts
+		mountPaths := make(map[string]struct{}, len(c.VolumeMounts))
+		for idx, vm := range c.VolumeMounts {
+			volumeMount := path.Child("volumeMounts").Index(idx)
+			if _, exists := volumes[vm.Name]; !exists {
+				errs = append(errs, field.NotFound(volumeMount.Child("name"), vm.Name))
+			}
+			if vm.MountPath == "" {
+				errs = append(errs, field.Required(volumeMount.Child("mountPath"), ""))
+				continue
+			}
+			if _, duplicate := mountPaths[vm.MountPath]; duplicate {
+				errs = append(errs, field.Invalid(volumeMount.Child("mountPath"), vm.MountPath, "must be unique"))
+			}
+			mountPaths[vm.MountPath] = struct{}{}
+		}
+	}
+
+	return errs
+}
+
+func validateProbe(p *core_v1.Probe, path *field.Path) field.ErrorList {
+	errs := field.ErrorList{}
+	if p == nil {
+		return errs
+	}
+
+	handlers := 0
+	if p.Exec != nil {
+		handlers++
+	}
+	if p.HTTPGet != nil {
+		handlers++
+		for _, msg := range validatePortNumOrName(p.HTTPGet.Port) {
+			errs = append(errs, field.Invalid(path.Child("httpGet", "port"), p.HTTPGet.Port.String(), msg))
+		}
+	}
+	if p.TCPSocket != nil {
+		handlers++
+		for _, msg := range validatePortNumOrName(p.TCPSocket.Port) {
+			errs = append(errs, field.Invalid(path.Child("tcpSocket", "port"), p.TCPSocket.Port.String(), msg))
+		}
+	}
+	if p.GRPC != nil {
+		handlers++
+		for _, msg := range k8s_validation.IsValidPortNum(int(p.GRPC.Port)) {
+			errs = append(errs, field.Invalid(path.Child("grpc", "port"), p.GRPC.Port, msg))
+		}
+	}
+	if handlers != 1 {
+		errs = append(errs, field.Invalid(path, handlers, "must specify exactly one handler type"))
+	}
+
+	for _, v := range []struct {
+		name  string
+		value int32
+	}{
+		{"initialDelaySeconds", p.InitialDelaySeconds},
+		{"timeoutSeconds", p.TimeoutSeconds},
+		{"periodSeconds", p.PeriodSeconds},
+		{"successThreshold", p.SuccessThreshold},
+		{"failureThreshold", p.FailureThreshold},
+	} {
+		if v.value < 0 {
+			errs = append(errs, field.Invalid(path.Child(v.name), v.value, "must be greater than or equal to 0"))
+		}
+	}
+
+	return errs
+}
+
+func validatePortNumOrName(port intstr.IntOrString) []string {
+	if port.Type == intstr.String {
+		return k8s_validation.IsValidPortName(port.StrVal)
+	}
+	return k8s_validation.IsValidPortNum(port.IntValue())
+}
+
+func validateSecurityContext(sc *core_v1.SecurityContext, path *field.Path) field.ErrorList {
+	errs := field.ErrorList{}
+	if sc == nil {
+		return errs
+	}
+
+	if sc.RunAsUser != nil {
+		for _, msg := range k8s_validation.IsValidUserID(*sc.RunAsUser) {
+			errs = append(errs, field.Invalid(path.Child("runAsUser"), *sc.RunAsUser, msg))
+		}
+	}
+	if sc.RunAsGroup != nil {
+		for _, msg := range k8s_validation.IsValidGroupID(*sc.RunAsGroup) {
+			errs = append(errs, field.Invalid(path.Child("runAsGroup"), *sc.RunAsGroup, msg))
+		}
+	}
+
+	if sc.AllowPrivilegeEscalation != nil && !*sc.AllowPrivilegeEscalation {
+		if sc.Privileged != nil && *sc.Privileged {
+			errs = append(errs, field.Invalid(path.Child("allowPrivilegeEscalation"), false,
+				"cannot set `allowPrivilegeEscalation` to false and `privileged` to true",
+			))
+		}
+		if sc.Capabilities != nil {
+			for _, c := range sc.Capabilities.Add {
+				if c == "SYS_ADMIN" || c == "CAP_SYS_ADMIN" {
+					errs = append(errs, field.Invalid(path.Child("allowPrivilegeEscalation"), false,
+						"cannot set `allowPrivilegeEscalation` to false and `capabilities.Add` CAP_SYS_ADMIN",
+					))
+				}
+			}
+		}
+	}
+
+	return errs
+}
+
+func validateToleration(t *core_v1.Toleration, path *field.Path) field.ErrorList {
+	errs := field.ErrorList{}
+
+	if t.Key != "" {
+		errs = append(errs, k8s_meta_validation.ValidateLabelName(t.Key, path.Child("key"))...)
+	}
+
+	switch t.Operator {
+	case "", core_v1.TolerationOpEqual:
+		if t.Key == "" {
+			errs = append(errs, field.Invalid(path.Child("operator"), t.Operator,
+				"operator must be Exists when `key` is empty",
+			))
+		}
+		for _, msg := range k8s_validation.IsValidLabelValue(t.Value) {
+			errs = append(errs, field.Invalid(path.Child("value"), t.Value, msg))
+		}
+	case core_v1.TolerationOpExists:
+		if t.Value != "" {
+			errs = append(errs, field.Invalid(path.Child("operator"), t.Value,
+				"value must be empty when `operator` is 'Exists'",
+			))
+		}
+	default:
+		errs = append(errs, field.NotSupported(path.Child("operator"), t.Operator,
+			[]core_v1.TolerationOperator{core_v1.TolerationOpEqual, core_v1.TolerationOpExists},
+		))
+	}
+
+	switch t.Effect {
+	case "", core_v1.TaintEffectNoSchedule, core_v1.TaintEffectPreferNoSchedule, core_v1.TaintEffectNoExecute:
+	default:
+		errs = append(errs, field.NotSupported(path.Child("effect"), t.Effect,
+			[]core_v1.TaintEffect{core_v1.TaintEffectNoSchedule, core_v1.TaintEffectPreferNoSchedule, core_v1.TaintEffectNoExecute},
+		))
+	}
+
+	if t.TolerationSeconds != nil && t.Effect != core_v1.TaintEffectNoExecute {
+		errs = append(errs, field.Invalid(path.Child("effect"), t.Effect,
+			fmt.Sprintf("effect must be '%s' when `tolerationSeconds` is set", core_v1.TaintEffectNoExecute),
+		))
+	}
+
+	return errs
+}
@@ -0,0 +1,113 @@
+package validation
+
+import (
+	"testing"
+
+	core_v1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/api/resource"
+	"k8s.io/apimachinery/pkg/util/validation/field"
+)
+
+func TestPod(t *testing.T) {
+	always := core_v1.ContainerRestartPolicyAlways
+	yes := true
+
+	valid := func() *core_v1.Pod {
+		return &core_v1.Pod{Spec: core_v1.PodSpec{
+			Containers: []core_v1.Container{{Name: "main", Image: "busybox"}},
+			Volumes: []core_v1.Volume{{
+				Name:         "cache",
+				VolumeSource: core_v1.VolumeSource{EmptyDir: &core_v1.EmptyDirVolumeSource{}},
+			}},
+		}}
+	}
+
+	for _, tc := range []struct {
+		name   string
+		mutate func(pod *core_v1.Pod)
+		errors []field.ErrorType
+	}{
+		{
+			name:   "valid",
+			mutate: func(pod *core_v1.Pod) {},
+		},
+		{
+			name: "volume without source",
+			mutate: func(pod *core_v1.Pod) {
+				pod.Spec.Volumes[0].EmptyDir = nil
+			},
+			errors: []field.ErrorType{field.ErrorTypeRequired},
+		},
+		{
+			name: "volume with multiple sources",
+			mutate: func(pod *core_v1.Pod) {
+				pod.Spec.Volumes[0].ConfigMap = &core_v1.ConfigMapVolumeSource{}
+			},
+			errors: []field.ErrorType{field.ErrorTypeForbidden},
+		},
+		{
+			name: "host pid with shared process namespace",
+			mutate: func(pod *core_v1.Pod) {
+				pod.Spec.HostPID = true
+				pod.Spec.ShareProcessNamespace = &yes
+			},
+			errors: []field.ErrorType{field.ErrorTypeInvalid},
+		},
+		{
+			name: "native sidecar",
+			mutate: func(pod *core_v1.Pod) {
+				pod.Spec.InitContainers = []core_v1.Container{{Name: "sidecar", Image: "sidecar", RestartPolicy: &always}}
+			},
+		},
+		{
+			name: "restart policy of regular container",
+			mutate: func(pod *core_v1.Pod) {
+				pod.Spec.Containers[0].RestartPolicy = &always
+			},
+			errors: []field.ErrorType{field.ErrorTypeForbidden},
+		},
+		{
+			name: "host network with different ports",
+			mutate: func(pod *core_v1.Pod) {
+				pod.Spec.HostNetwork = true
+				pod.Spec.Containers[0].Ports = []core_v1.ContainerPort{{ContainerPort: 8080, HostPort: 9090}}
+			},
+			errors: []field.ErrorType{field.ErrorTypeInvalid},
+		},
+		{
+			name: "duplicate host ports",
+			mutate: func(pod *core_v1.Pod) {
+				pod.Spec.Containers[0].Ports = []core_v1.ContainerPort{{ContainerPort: 8080, HostPort: 9090}}
+				pod.Spec.Containers = append(pod.Spec.Containers, core_v1.Container{
+					Name: "sidecar", Image: "sidecar", Ports: []core_v1.ContainerPort{{ContainerPort: 8081, HostPort: 9090}},
+				})
+			},
+			errors: []field.ErrorType{field.ErrorTypeDuplicate},
+		},
+		{
+			name: "requests over limits",
+			mutate: func(pod *core_v1.Pod) {
+				pod.Spec.Containers[0].Resources = core_v1.ResourceRequirements{
+					Limits:   core_v1.ResourceList{core_v1.ResourceCPU: resource.MustParse("100m")},
+					Requests: core_v1.ResourceList{core_v1.ResourceCPU: resource.MustParse("200m")},
+				}
+			},
+			errors: []field.ErrorType{field.ErrorTypeInvalid},
+		},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			pod := valid()
+			tc.mutate(pod)
+
+			errs := Pod(pod)
+			if len(errs) != len(tc.errors) {
+				t.Fatalf("unexpected errors: got %v, want %v", errs, tc.errors)
+			}
+			for idx, err := range errs {
+				if err.Type != tc.errors[idx] {
+					t.Errorf("unexpected error: got %v, want %v", err, tc.errors[idx])
+				}
+			}
+		})
+	}
+}